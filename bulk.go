@@ -0,0 +1,391 @@
+package tableorm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//BatchWriteRow单次请求的限制
+const (
+	batchWriteRowLimit  = 200
+	batchWriteSizeLimit = 4 * 1024 * 1024
+)
+
+type BulkWriterOptions struct {
+	//单批最大行数，默认200，不能超过BatchWriteRow的限制
+	MaxRows int
+	//单批最大字节数，默认4MB，不能超过BatchWriteRow的限制，单行超过时Save/Update/Delete返回BulkRowTooLarge
+	MaxBytes int
+	//定时刷新间隔，默认1秒，即使未达到行数和字节数也会写入
+	FlushInterval time.Duration
+	//同时进行的批量写入数，默认4，同一行总是由同一个写入协程按调用顺序写入
+	Concurrency int
+	//缓冲的最大行数，写满后Save/Update/Delete会阻塞，直到有批次写完，默认MaxRows*Concurrency
+	QueueSize int
+	//写入失败时的回调，在写入协程中调用，为空时发送到Errors()
+	//两者都没有处理时失败只记录日志，Close返回失败的行数
+	OnError func(err *BulkError)
+}
+
+//批量写入失败，Objects为写入失败的对象
+type BulkError struct {
+	Objects []interface{}
+	Err     error
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("bulk write %d rows error: %s", len(e.Objects), e.Err)
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+//异步批量写入，缓冲Save/Update/Delete，按行数、字节数或时间间隔合并为BatchWriteRow
+//不支持回填自增ID，使用自增ID的模型请直接调用db.Save
+type BulkWriter struct {
+	//失败的行数，放在第一个字段保证32位平台上原子操作的对齐
+	failed int64
+
+	db      *DB
+	options BulkWriterOptions
+
+	input chan *bulkItem
+	//每个写入协程一个通道，同一行按key的哈希固定分配，保证写入顺序
+	shards []chan *bulkBatch
+	errors chan *BulkError
+	//没有key的行轮流分配
+	next int
+	//写入一个批次，默认为BatchWriteRow，测试中替换
+	writeBatch func(batch *bulkBatch)
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type bulkItem struct {
+	obj       interface{}
+	rowChange tablestore.RowChange
+	key       string
+	size      int
+}
+
+//一个批次，按表分组，与BatchWriteRowRequest中的顺序一致，用于根据结果中的Index找到对应对象
+type bulkBatch struct {
+	items map[string][]*bulkItem
+	keys  map[string]bool
+	rows  int
+	size  int
+}
+
+func newBulkBatch() *bulkBatch {
+	return &bulkBatch{
+		items: map[string][]*bulkItem{},
+		keys:  map[string]bool{},
+	}
+}
+
+func (b *bulkBatch) add(item *bulkItem) {
+	tableName := item.rowChange.GetTableName()
+	b.items[tableName] = append(b.items[tableName], item)
+	b.keys[item.key] = true
+	b.rows++
+	b.size += item.size
+}
+
+func (db *DB) NewBulkWriter(options BulkWriterOptions) *BulkWriter {
+	return newBulkWriter(db, options, nil)
+}
+
+//writeBatch为空时使用BatchWriteRow写入
+func newBulkWriter(db *DB, options BulkWriterOptions, writeBatch func(batch *bulkBatch)) *BulkWriter {
+	if options.MaxRows <= 0 || options.MaxRows > batchWriteRowLimit {
+		options.MaxRows = batchWriteRowLimit
+	}
+	if options.MaxBytes <= 0 || options.MaxBytes > batchWriteSizeLimit {
+		options.MaxBytes = batchWriteSizeLimit
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 4
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = options.MaxRows * options.Concurrency
+	}
+
+	w := &BulkWriter{
+		db:         db,
+		options:    options,
+		input:      make(chan *bulkItem, options.QueueSize),
+		shards:     make([]chan *bulkBatch, options.Concurrency),
+		errors:     make(chan *BulkError, options.Concurrency),
+		writeBatch: writeBatch,
+	}
+	if w.writeBatch == nil {
+		w.writeBatch = w.write
+	}
+
+	w.wg.Add(options.Concurrency)
+	for i := range w.shards {
+		w.shards[i] = make(chan *bulkBatch)
+		go w.worker(w.shards[i])
+	}
+
+	go w.dispatch()
+	return w
+}
+
+//没有设置OnError时，写入失败会发送到这里，缓冲区大小为Concurrency
+//没有及时读取导致缓冲区满时不会阻塞写入，失败只记录日志，仍会计入Close返回的失败行数
+//Close之后会被关闭
+func (w *BulkWriter) Errors() <-chan *BulkError {
+	return w.errors
+}
+
+//缓冲覆盖写入，ID在调用时生成并回填，支持 *T、T、[]T、[]*T
+func (w *BulkWriter) Save(objList ...interface{}) error {
+	rows, err := expandObjects(objList)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		rowChange, err := row.saveRowChange(w.db)
+		if err != nil {
+			return err
+		}
+		if err := w.add(row.obj, rowChange, rowChange.PrimaryKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//缓冲更新，行不存在时会作为写入失败报告
+func (w *BulkWriter) Update(objList ...interface{}) error {
+	rows, err := expandObjects(objList)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		rowChange, err := w.db.GetUpdateRowChange(row.obj)
+		if err != nil {
+			return err
+		}
+		if err := w.add(row.obj, rowChange, rowChange.PrimaryKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//缓冲删除
+func (w *BulkWriter) Delete(objList ...interface{}) error {
+	rows, err := expandObjects(objList)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		rowChange, err := w.db.GetDeleteRowChange(row.obj)
+		if err != nil {
+			return err
+		}
+		if err := w.add(row.obj, rowChange, rowChange.PrimaryKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//行的唯一标识，用于避免同一批次中出现重复的行，例如 user/_id=abc
+//[]byte按十六进制编码，自增列由服务端生成，每次都是新行，返回空表示不去重
+func bulkRowKey(tableName string, pk *tablestore.PrimaryKey) string {
+	columns := []string{}
+	for _, column := range pk.PrimaryKeys {
+		if column.PrimaryKeyOption == tablestore.AUTO_INCREMENT {
+			return ""
+		}
+		value := column.Value
+		if b, ok := value.([]byte); ok {
+			value = hex.EncodeToString(b)
+		}
+		columns = append(columns, fmt.Sprintf("%s=%v", column.ColumnName, value))
+	}
+	return tableName + "/" + strings.Join(columns, ",")
+}
+
+//缓冲区满时阻塞，实现背压
+func (w *BulkWriter) add(obj interface{}, rowChange tablestore.RowChange, pk *tablestore.PrimaryKey) error {
+	item := &bulkItem{
+		obj:       obj,
+		rowChange: rowChange,
+		key:       bulkRowKey(rowChange.GetTableName(), pk),
+		size:      len(rowChange.Serialize()),
+	}
+	if item.size > w.options.MaxBytes {
+		return fmt.Errorf("%w: %s row of %d bytes exceeds MaxBytes %d", BulkRowTooLarge, rowChange.GetTableName(), item.size, w.options.MaxBytes)
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return BulkWriterClosed
+	}
+	w.input <- item
+	return nil
+}
+
+//写入剩余的数据并等待所有批次完成，有写入失败时返回失败的行数
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return BulkWriterClosed
+	}
+	w.closed = true
+	close(w.input)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	close(w.errors)
+
+	if failed := atomic.LoadInt64(&w.failed); failed > 0 {
+		return fmt.Errorf("bulk writer: %d rows failed to write", failed)
+	}
+	return nil
+}
+
+//行分配到的写入协程，同一行总是分配到同一个写入协程，避免同一行的多次写入被并发发送而乱序
+//自增列的行没有key，每次都是新行，轮流分配
+func (w *BulkWriter) shard(item *bulkItem) int {
+	if item.key == "" {
+		w.next = (w.next + 1) % len(w.shards)
+		return w.next
+	}
+	h := fnv.New32a()
+	h.Write([]byte(item.key))
+	return int(h.Sum32() % uint32(len(w.shards)))
+}
+
+//合并缓冲区中的数据为批次，每个写入协程单独合并，交给对应的写入协程
+//写入协程在忙时这里会阻塞，缓冲区随之写满，调用方阻塞
+func (w *BulkWriter) dispatch() {
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make([]*bulkBatch, len(w.shards))
+	for i := range batches {
+		batches[i] = newBulkBatch()
+	}
+	flush := func(i int) {
+		if batches[i].rows == 0 {
+			return
+		}
+		w.shards[i] <- batches[i]
+		batches[i] = newBulkBatch()
+	}
+
+	for {
+		select {
+		case item, ok := <-w.input:
+			if !ok {
+				for i, shard := range w.shards {
+					flush(i)
+					close(shard)
+				}
+				return
+			}
+
+			//同一批次中不能有重复的行，超过大小限制时也先写入已有的数据
+			i := w.shard(item)
+			batch := batches[i]
+			if (item.key != "" && batch.keys[item.key]) || batch.size+item.size > w.options.MaxBytes {
+				flush(i)
+			}
+			batches[i].add(item)
+			if batches[i].rows >= w.options.MaxRows {
+				flush(i)
+			}
+		case <-ticker.C:
+			for i := range w.shards {
+				flush(i)
+			}
+		}
+	}
+}
+
+//按顺序写入分配到的批次，上一个批次写完才会写下一个
+func (w *BulkWriter) worker(batches <-chan *bulkBatch) {
+	defer w.wg.Done()
+	for batch := range batches {
+		w.writeBatch(batch)
+	}
+}
+
+func (w *BulkWriter) write(batch *bulkBatch) {
+	batchWriteReq := &tablestore.BatchWriteRowRequest{}
+	for _, items := range batch.items {
+		for _, item := range items {
+			batchWriteReq.AddRowChange(item.rowChange)
+		}
+	}
+
+	resp, err := w.db.client.BatchWriteRow(batchWriteReq)
+	if err != nil {
+		objects := []interface{}{}
+		for _, items := range batch.items {
+			for _, item := range items {
+				objects = append(objects, item.obj)
+			}
+		}
+		w.report(&BulkError{Objects: objects, Err: err})
+		return
+	}
+
+	//部分失败时按Index找到对应的对象，相同错误的对象合并报告
+	failed := map[string]*BulkError{}
+	for tableName, results := range resp.TableToRowsResult {
+		for _, result := range results {
+			if result.IsSucceed {
+				continue
+			}
+			message := fmt.Sprintf("%s %s", result.Error.Code, result.Error.Message)
+			bulkErr, ok := failed[message]
+			if !ok {
+				bulkErr = &BulkError{Err: fmt.Errorf("write row error, error: %s", message)}
+				failed[message] = bulkErr
+			}
+			bulkErr.Objects = append(bulkErr.Objects, batch.items[tableName][result.Index].obj)
+		}
+	}
+	for _, bulkErr := range failed {
+		w.report(bulkErr)
+	}
+}
+
+func (w *BulkWriter) report(err *BulkError) {
+	atomic.AddInt64(&w.failed, int64(len(err.Objects)))
+	if w.options.OnError != nil {
+		w.options.OnError(err)
+		return
+	}
+
+	select {
+	case w.errors <- err:
+	default:
+		//没有人读取时不能阻塞写入，只记录日志
+		log.Printf("%s", err)
+	}
+}
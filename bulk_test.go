@@ -0,0 +1,275 @@
+package tableorm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//按顺序把items交给dispatch，返回合并后的批次，按写入协程的顺序排列
+func dispatchItems(options BulkWriterOptions, items ...*bulkItem) []*bulkBatch {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	w := &BulkWriter{
+		options: options,
+		input:   make(chan *bulkItem, len(items)),
+		shards:  make([]chan *bulkBatch, options.Concurrency),
+	}
+	for i := range w.shards {
+		w.shards[i] = make(chan *bulkBatch, len(items))
+	}
+	for _, item := range items {
+		w.input <- item
+	}
+	close(w.input)
+	w.dispatch()
+
+	batches := []*bulkBatch{}
+	for _, shard := range w.shards {
+		for batch := range shard {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+func newTestBulkItem(table, key string, size int) *bulkItem {
+	return &bulkItem{rowChange: &tablestore.PutRowChange{TableName: table}, key: key, size: size}
+}
+
+func TestBulkDispatch(t *testing.T) {
+	options := BulkWriterOptions{MaxRows: 3, MaxBytes: 100, FlushInterval: time.Hour}
+	tests := []struct {
+		name  string
+		items []*bulkItem
+		rows  []int
+	}{
+		{"max rows", []*bulkItem{
+			newTestBulkItem("user", "1", 1), newTestBulkItem("user", "2", 1), newTestBulkItem("user", "3", 1), newTestBulkItem("user", "4", 1),
+		}, []int{3, 1}},
+		{"max bytes", []*bulkItem{
+			newTestBulkItem("user", "1", 60), newTestBulkItem("user", "2", 60), newTestBulkItem("user", "3", 40),
+		}, []int{1, 2}},
+		{"duplicate row", []*bulkItem{
+			newTestBulkItem("user", "1", 1), newTestBulkItem("user", "2", 1), newTestBulkItem("user", "1", 1),
+		}, []int{2, 1}},
+		{"multiple tables", []*bulkItem{
+			newTestBulkItem("user", "user/1", 1), newTestBulkItem("book", "book/1", 1),
+		}, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := dispatchItems(options, tt.items...)
+			rows := []int{}
+			for _, batch := range batches {
+				rows = append(rows, batch.rows)
+			}
+			if len(rows) != len(tt.rows) {
+				t.Fatalf("batch rows = %v, want %v", rows, tt.rows)
+			}
+			for i := range rows {
+				if rows[i] != tt.rows[i] {
+					t.Errorf("batch rows = %v, want %v", rows, tt.rows)
+				}
+			}
+		})
+	}
+}
+
+//批次中按表分组的顺序与BatchWriteRowRequest一致，用于根据结果中的Index找到对应对象
+func TestBulkBatchGroupsByTable(t *testing.T) {
+	user1, book, user2 := newTestBulkItem("user", "u1", 1), newTestBulkItem("book", "b1", 1), newTestBulkItem("user", "u2", 1)
+	batches := dispatchItems(BulkWriterOptions{MaxRows: 10, MaxBytes: 100, FlushInterval: time.Hour}, user1, book, user2)
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+	items := batches[0].items
+	if len(items["user"]) != 2 || items["user"][0] != user1 || items["user"][1] != user2 || len(items["book"]) != 1 || items["book"][0] != book {
+		t.Errorf("batch items = %v, want user [u1 u2] and book [b1]", items)
+	}
+}
+
+func TestNewBulkWriterOptions(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	w := db.NewBulkWriter(BulkWriterOptions{MaxRows: 1000, MaxBytes: -1})
+	got := w.options
+	if got.MaxRows != batchWriteRowLimit || got.MaxBytes != batchWriteSizeLimit || got.FlushInterval != time.Second || got.Concurrency != 4 || got.QueueSize != batchWriteRowLimit*4 {
+		t.Errorf("options = %+v, want defaults", got)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := w.Close(); err != BulkWriterClosed {
+		t.Errorf("second Close() error = %v, want %v", err, BulkWriterClosed)
+	}
+	if err := w.Delete(&upsertUser{ID: "a"}); err != BulkWriterClosed {
+		t.Errorf("Delete() after Close error = %v, want %v", err, BulkWriterClosed)
+	}
+	if _, ok := <-w.Errors(); ok {
+		t.Error("Errors() not closed after Close")
+	}
+}
+
+func TestBulkErrorUnwrap(t *testing.T) {
+	cause := errors.New("server busy")
+	err := &BulkError{Objects: []interface{}{1, 2}, Err: cause}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is(BulkError, cause) = false")
+	}
+	if want := "bulk write 2 rows error: server busy"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func newTestPrimaryKey(values ...interface{}) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	for i := 0; i < len(values); i += 2 {
+		pk.AddPrimaryKeyColumn(values[i].(string), values[i+1])
+	}
+	return pk
+}
+
+func TestBulkRowKey(t *testing.T) {
+	autoIncrement := newTestPrimaryKey("tenant", "a")
+	autoIncrement.AddPrimaryKeyColumnWithAutoIncrement("seq")
+
+	tests := []struct {
+		name  string
+		table string
+		pk    *tablestore.PrimaryKey
+		want  string
+	}{
+		{"string", "user", newTestPrimaryKey("_id", "abc"), "user/_id=abc"},
+		{"int", "metric", newTestPrimaryKey("tenant", "a", "ts", int64(10)), "metric/tenant=a,ts=10"},
+		{"bytes", "blob", newTestPrimaryKey("_id", []byte{0xab, 0x01}), "blob/_id=ab01"},
+		{"auto increment", "metric", autoIncrement, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bulkRowKey(tt.table, tt.pk); got != tt.want {
+				t.Errorf("bulkRowKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkRowKeyIdenticalPrimaryKeys(t *testing.T) {
+	//相同主键的两个PrimaryKey对象，key必须相同，否则同一批次中会出现重复行
+	first := bulkRowKey("user", newTestPrimaryKey("_id", "abc", "bin", []byte("x")))
+	second := bulkRowKey("user", newTestPrimaryKey("_id", "abc", "bin", []byte("x")))
+	if first != second {
+		t.Errorf("identical primary keys give different keys %q and %q", first, second)
+	}
+
+	if other := bulkRowKey("user", newTestPrimaryKey("_id", "abd", "bin", []byte("x"))); other == first {
+		t.Errorf("different primary keys give the same key %q", other)
+	}
+	if other := bulkRowKey("book", newTestPrimaryKey("_id", "abc", "bin", []byte("x"))); other == first {
+		t.Errorf("different tables give the same key %q", other)
+	}
+}
+
+func TestBulkBatchSplitsDuplicateRows(t *testing.T) {
+	items := []*bulkItem{}
+	for i := 0; i < 2; i++ {
+		rowChange := &tablestore.DeleteRowChange{TableName: "user", PrimaryKey: newTestPrimaryKey("_id", "abc")}
+		items = append(items, &bulkItem{rowChange: rowChange, key: bulkRowKey("user", rowChange.PrimaryKey), size: 1})
+	}
+	batches := dispatchItems(BulkWriterOptions{MaxRows: 10, MaxBytes: 1 << 20, FlushInterval: time.Hour}, items...)
+
+	for _, batch := range batches {
+		if batch.rows != 1 {
+			t.Errorf("batch has %d rows, want 1", batch.rows)
+		}
+	}
+	if len(batches) != 2 {
+		t.Errorf("got %d batches, want 2", len(batches))
+	}
+}
+
+//同一行的多次写入分配到同一个写入协程，即使有多个写入协程并发写入，也按调用顺序写入
+func TestBulkWriterKeepsRowOrder(t *testing.T) {
+	const keys, versions = 7, 50
+
+	var mu sync.Mutex
+	written := map[string][]int64{}
+	writeBatch := func(batch *bulkBatch) {
+		//随机延迟，模拟并发写入时先发送的请求后完成
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, item := range batch.items["upsertuser"] {
+			user := item.obj.(*upsertUser)
+			written[user.ID] = append(written[user.ID], user.Age)
+		}
+	}
+
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	w := newBulkWriter(db, BulkWriterOptions{MaxRows: 3, Concurrency: 4, FlushInterval: time.Millisecond}, writeBatch)
+	for version := 0; version < versions; version++ {
+		for key := 0; key < keys; key++ {
+			if err := w.Save(&upsertUser{ID: fmt.Sprintf("user%d", key), Age: int64(version)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != keys {
+		t.Fatalf("written %d rows, want %d", len(written), keys)
+	}
+	for id, ages := range written {
+		if len(ages) != versions {
+			t.Errorf("%s written %d times, want %d", id, len(ages), versions)
+			continue
+		}
+		for i, age := range ages {
+			if age != int64(i) {
+				t.Errorf("%s written in order %v", id, ages)
+				break
+			}
+		}
+	}
+}
+
+func TestBulkShardSameKey(t *testing.T) {
+	w := &BulkWriter{shards: make([]chan *bulkBatch, 8)}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user/_id=%d", i)
+		if w.shard(&bulkItem{key: key}) != w.shard(&bulkItem{key: key}) {
+			t.Fatalf("%s assigned to different shards", key)
+		}
+	}
+
+	//自增列的行没有key，轮流分配
+	used := map[int]bool{}
+	for i := 0; i < len(w.shards); i++ {
+		used[w.shard(&bulkItem{})] = true
+	}
+	if len(used) != len(w.shards) {
+		t.Errorf("rows without key used %d shards, want %d", len(used), len(w.shards))
+	}
+}
+
+func TestBulkWriterRowTooLarge(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	w := newBulkWriter(db, BulkWriterOptions{MaxBytes: 200}, func(batch *bulkBatch) {})
+	defer w.Close()
+
+	err := w.Save(&upsertUser{ID: "1", Name: strings.Repeat("a", 300)})
+	if !errors.Is(err, BulkRowTooLarge) {
+		t.Errorf("Save() error = %v, want %v", err, BulkRowTooLarge)
+	}
+	if err := w.Save(&upsertUser{ID: "1", Name: "a"}); err != nil {
+		t.Errorf("Save() error = %v", err)
+	}
+}
@@ -15,17 +15,22 @@ func NewDB(endPoint, instanceName, accessKeyId, accessKeySecret string, options
 		offset:        -1,
 		limit:         -1,
 		getTotalCount: false,
+		indexAliases:  newIndexAliasCache(),
 	}
 }
 
 type DB struct {
-	client        *tablestore.TableStoreClient
-	query         search.Query
-	offset        int
-	limit         int
-	getTotalCount bool
-	sorters       []search.Sorter
-	token         []byte
+	client         *tablestore.TableStoreClient
+	query          search.Query
+	offset         int
+	limit          int
+	getTotalCount  bool
+	sorters        []search.Sorter
+	token          []byte
+	naming         NamingStrategy
+	indexAliases   *indexAliasCache
+	migrateOptions MigrateOptions
+	secondaryIndex string
 	//Collapse      *Collapse
 }
 
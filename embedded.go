@@ -0,0 +1,118 @@
+package tableorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//模型的字段，匿名嵌入的结构体会被展开，例如所有模型共用的 Base{ID, CreatedAt, UpdatedAt}
+type modelField struct {
+	//字段名，嵌入结构体中的字段为提升后的字段名，可以直接用于reflections的各个方法
+	Name string
+	//json tag中的列名，嵌入结构体指定了前缀时已加上前缀，没有json tag时为空
+	Column string
+	//字段在结构体中的位置，与reflect.StructField.Index相同
+	index []int
+}
+
+//嵌入层级，模型本身的字段为0
+func (f *modelField) depth() int {
+	return len(f.index) - 1
+}
+
+//需要展开的匿名嵌入结构体，time.Time、sql.Null*以及自定义类型作为普通字段处理
+func isEmbeddedStruct(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && !isTimeType(typ) && !isNullType(typ) && !implements(typ, tableValuerType)
+}
+
+//获取模型的所有字段，按定义顺序展开匿名嵌入的结构体
+//同名字段按Go的规则处理：浅层的字段覆盖深层的字段，同一层级同名的字段都无法访问，会被忽略
+//列名相同时浅层的字段优先，同一层级列名相同时CheckModel会报错
+func getModelFields(obj interface{}) ([]*modelField, error) {
+	typ := reflect.TypeOf(obj)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model must be a struct, it's %T now", obj)
+	}
+
+	candidates, err := collectModelFields(typ, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	minDepth := map[string]int{}
+	visible := []*modelField{}
+	for _, field := range candidates {
+		structField, ok := typ.FieldByName(field.Name)
+		if !ok || !reflect.DeepEqual(structField.Index, field.index) {
+			continue
+		}
+		visible = append(visible, field)
+		if depth, ok := minDepth[field.Column]; !ok || field.depth() < depth {
+			minDepth[field.Column] = field.depth()
+		}
+	}
+
+	fields := []*modelField{}
+	for _, field := range visible {
+		if field.Column != "" && field.Column != "-" && field.depth() > minDepth[field.Column] {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+//模型的所有字段名，替代reflections.Fields，包括嵌入结构体中的字段
+func getModelFieldNames(obj interface{}) ([]string, error) {
+	fields, err := getModelFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	return names, nil
+}
+
+//递归收集字段，嵌入结构体上通过 tableorm:"prefix:audit_" 给其中的列名加上前缀
+func collectModelFields(typ reflect.Type, index []int, prefix string) ([]*modelField, error) {
+	fields := []*modelField{}
+	for i := 0; i < typ.NumField(); i++ {
+		structField := typ.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if structField.Anonymous {
+			if isEmbeddedStruct(structField.Type) {
+				settings := parseTableormTag(structField.Tag.Get("tableorm"))
+				subFields, err := collectModelFields(structField.Type, fieldIndex, prefix+settings["prefix"])
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, subFields...)
+				continue
+			}
+			//嵌入的指针为空时无法读写其中的字段
+			if structField.Type.Kind() == reflect.Ptr && isEmbeddedStruct(structField.Type.Elem()) {
+				return nil, fmt.Errorf("embedded pointer %s is not supported, embed %s instead", structField.Name, structField.Type.Elem())
+			}
+		}
+
+		//未导出的字段不存入数据库
+		if structField.PkgPath != "" {
+			continue
+		}
+
+		column := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if column != "" && column != "-" {
+			column = prefix + column
+		}
+		fields = append(fields, &modelField{Name: structField.Name, Column: column, index: fieldIndex})
+	}
+	return fields, nil
+}
@@ -0,0 +1,125 @@
+package tableorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID        string    `json:"_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type testAudit struct {
+	By string `json:"by"`
+	At int64  `json:"at"`
+}
+
+type testTrace struct {
+	By string `json:"traceBy"`
+}
+
+// 外层的Name覆盖Base.Name，两个嵌入结构体同一层级的By都无法访问
+type testArticle struct {
+	testBase
+	Name  string `json:"title"`
+	Audit testAudit
+	testAudit
+	testTrace
+	Body string `json:"body"`
+}
+
+// 外层字段名不同但列名与嵌入字段相同，外层优先
+type testColumnShadow struct {
+	testBase
+	Title string `json:"name"`
+}
+
+type testPrefixed struct {
+	ID        string `json:"_id"`
+	testAudit `tableorm:"prefix:audit_"`
+}
+
+type testEmbeddedPointer struct {
+	*testBase
+}
+
+func TestGetModelFields(t *testing.T) {
+	type field struct {
+		Name   string
+		Column string
+	}
+	tests := []struct {
+		name string
+		obj  interface{}
+		want []field
+	}{
+		{
+			name: "shadowed field",
+			obj:  &testArticle{},
+			want: []field{{"ID", "_id"}, {"CreatedAt", "createdAt"}, {"Name", "title"}, {"Audit", ""}, {"At", "at"}, {"Body", "body"}},
+		},
+		{
+			name: "shadowed column",
+			obj:  &testColumnShadow{},
+			want: []field{{"ID", "_id"}, {"CreatedAt", "createdAt"}, {"Title", "name"}},
+		},
+		{
+			name: "prefix",
+			obj:  testPrefixed{},
+			want: []field{{"ID", "_id"}, {"By", "audit_by"}, {"At", "audit_at"}},
+		},
+		{
+			name: "time is not expanded",
+			obj:  &testBase{},
+			want: []field{{"ID", "_id"}, {"Name", "name"}, {"CreatedAt", "createdAt"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := getModelFields(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []field{}
+			for _, f := range fields {
+				got = append(got, field{f.Name, f.Column})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getModelFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetModelFieldsError(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+		want string
+	}{
+		{"embedded pointer", &testEmbeddedPointer{}, "embedded pointer"},
+		{"not struct", "user", "must be a struct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := getModelFields(tt.obj)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("getModelFields() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadShadowedField(t *testing.T) {
+	article := &testArticle{}
+	if err := setFieldValue(article, "Name", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if article.Name != "hello" || article.testBase.Name != "" {
+		t.Errorf("Name = %q, Base.Name = %q, want outer field set", article.Name, article.testBase.Name)
+	}
+}
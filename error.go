@@ -1,9 +1,61 @@
 package tableorm
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+)
 
 var (
-	NotResultFound  = fmt.Errorf("no result found")
-	NotAllSuccess   = fmt.Errorf("no all success")
-	IDFieldNotExist = fmt.Errorf(`primary key "_id" must be define`)
+	NotResultFound   = fmt.Errorf("no result found")
+	NotAllSuccess    = fmt.Errorf("no all success")
+	IDFieldNotExist  = fmt.Errorf(`primary key "_id" must be define`)
+	RowAlreadyExist  = fmt.Errorf("row already exist")
+	RowNotExist      = fmt.Errorf("row not exist")
+	PrimaryKeyEmpty  = fmt.Errorf("primary key is empty")
+	NotAddressable   = fmt.Errorf("value is not addressable, pass a pointer instead")
+	BulkWriterClosed = fmt.Errorf("bulk writer closed")
+	BulkRowTooLarge  = fmt.Errorf("bulk row too large")
+	MigrationLocked  = fmt.Errorf("migration is locked by another instance")
+	IndexNotReady    = fmt.Errorf("index not ready")
+	ValueOverflow    = fmt.Errorf("value overflow")
 )
+
+//行存在性条件不满足时，TableStore返回的错误码
+const conditionCheckFailCode = "OTSConditionCheckFail"
+
+//判断是否为条件写入失败，例如期望行不存在但行已存在
+func isConditionCheckFail(err error) bool {
+	var otsErr *tablestore.OtsError
+	return errors.As(err, &otsErr) && otsErr.Code == conditionCheckFailCode
+}
+
+//表已存在时TableStore返回的错误码，多个实例同时创建同一张表时会出现
+const objectAlreadyExistCode = "OTSObjectAlreadyExist"
+
+func isObjectAlreadyExist(err error) bool {
+	var otsErr *tablestore.OtsError
+	return errors.As(err, &otsErr) && otsErr.Code == objectAlreadyExistCode
+}
+
+//表刚创建完成时读写会返回该错误码，需要等待一段时间
+const tableNotReadyCode = "OTSTableNotReady"
+
+func isTableNotReady(err error) bool {
+	var otsErr *tablestore.OtsError
+	return errors.As(err, &otsErr) && otsErr.Code == tableNotReadyCode
+}
+
+//AutoMigrate中所有模型的错误，每个模型一个
+type MigrateError struct {
+	Errors []error
+}
+
+func (e *MigrateError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d models failed to migrate: %s", len(e.Errors), strings.Join(messages, "; "))
+}
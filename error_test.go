@@ -0,0 +1,53 @@
+package tableorm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type migrateNoIDModel struct {
+	Name string `json:"name"`
+}
+
+type migrateBadFieldModel struct {
+	ID   string            `json:"_id"`
+	Tags map[string]string `json:"tags"`
+}
+
+func TestMigrateErrorMessage(t *testing.T) {
+	err := &MigrateError{Errors: []error{errors.New("a failed"), errors.New("b failed")}}
+	want := "2 models failed to migrate: a failed; b failed"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+//所有模型都会同步，每个失败的模型对应一个错误
+func TestAutoMigrateAggregatesErrors(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	results, err := db.AutoMigrate(&migrateNoIDModel{}, &migrateBadFieldModel{})
+
+	var migrateErr *MigrateError
+	if !errors.As(err, &migrateErr) {
+		t.Fatalf("AutoMigrate() error = %v, want *MigrateError", err)
+	}
+	if len(migrateErr.Errors) != 2 {
+		t.Fatalf("MigrateError.Errors = %v, want 2 errors", migrateErr.Errors)
+	}
+	if !errors.Is(migrateErr.Errors[0], IDFieldNotExist) {
+		t.Errorf("Errors[0] = %v, want wrapping %v", migrateErr.Errors[0], IDFieldNotExist)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("AutoMigrate() returned %d results, want 2", len(results))
+	}
+	for i, table := range []string{"migratenoidmodel", "migratebadfieldmodel"} {
+		if results[i].Table != table || results[i].Err == nil {
+			t.Errorf("results[%d] = %+v, want failed result of table %s", i, results[i], table)
+		}
+		if !strings.Contains(migrateErr.Errors[i].Error(), table) {
+			t.Errorf("Errors[%d] = %v, want table name %s", i, migrateErr.Errors[i], table)
+		}
+	}
+}
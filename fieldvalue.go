@@ -0,0 +1,289 @@
+package tableorm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/oleiade/reflections"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+//sql.NullString等可以为空的类型，需要同时实现driver.Valuer和sql.Scanner
+func isNullType(typ reflect.Type) bool {
+	return typ.Kind() != reflect.Ptr && typ.Implements(valuerType) && reflect.PtrTo(typ).Implements(scannerType)
+}
+
+//json tag中是否有omitempty，例如 json:"name,omitempty"
+func hasOmitEmpty(obj interface{}, field string) bool {
+	tag, _ := reflections.GetFieldTag(obj, field, "json")
+	for _, option := range strings.Split(tag, ",")[1:] {
+		if option == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
+
+//可以为空的字段：指针、sql.Null*类型、time.Time以及omitempty的字段，列不存在时读取为空
+func isNullableField(obj interface{}, field string) bool {
+	typ, ok := getFieldType(obj, field)
+	if !ok {
+		return false
+	}
+	return typ.Kind() == reflect.Ptr || isNullType(typ) || typ == timeType || hasOmitEmpty(obj, field)
+}
+
+//未设置的字段：omitempty的零值以及time.Time的零值，写入和更新时都跳过该列，更新时保留数据库中原有的值
+//零值不是有效的时间，按时间戳存储为公元1年，读取后也无法与真实的时间区分
+func isUnsetField(obj interface{}, field string) (bool, error) {
+	value, err := reflections.GetField(obj, field)
+	if err != nil {
+		return false, err
+	}
+	if hasOmitEmpty(obj, field) && reflect.ValueOf(value).IsZero() {
+		return true, nil
+	}
+	t, ok := value.(time.Time)
+	return ok && t.IsZero(), nil
+}
+
+//读取字段并转换为写入TableStore的列值
+//ok为false表示值为空（空指针、无效的sql.Null*、omitempty的零值、time.Time的零值），写入时跳过该列
+//更新时先通过isUnsetField跳过未设置的字段，其他为空的值删除该列
+func getColumnValue(obj interface{}, field string) (value interface{}, ok bool, err error) {
+	value, err = reflections.GetField(obj, field)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if unset, err := isUnsetField(obj, field); err != nil || unset {
+		return nil, false, err
+	}
+
+	//自定义类型通过TableValue转换，空指针视为空
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false, nil
+	}
+	tableValue, isValuer, err := getTableValue(field, value)
+	if err != nil {
+		return nil, false, err
+	}
+	if isValuer {
+		return tableValue, tableValue != nil, nil
+	}
+
+	format, isTime, err := getTimeFormat(obj, field)
+	if err != nil {
+		return nil, false, err
+	}
+	if isTime {
+		switch t := value.(type) {
+		case time.Time:
+			return format.encode(t), true, nil
+		case *time.Time:
+			if t == nil {
+				return nil, false, nil
+			}
+			return format.encode(*t), true, nil
+		case sql.NullTime:
+			if !t.Valid {
+				return nil, false, nil
+			}
+			return format.encode(t.Time), true, nil
+		}
+	}
+
+	//指针取指向的值
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		value = v.Elem().Interface()
+	}
+
+	//sql.Null*类型通过Value()取值，无效时为nil
+	if valuer, ok := value.(driver.Valuer); ok {
+		value, err = valuer.Value()
+		if err != nil {
+			return nil, false, fmt.Errorf("get value of field %s error: %w", field, err)
+		}
+		if value == nil {
+			return nil, false, nil
+		}
+	}
+
+	value, err = toColumnNumber(field, value)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+//将TableStore读出的列值转换为字段类型后写入字段
+func setFieldValue(obj interface{}, field string, value interface{}) error {
+	typ, ok := getFieldType(obj, field)
+	if !ok {
+		return reflections.SetField(obj, field, value)
+	}
+
+	//自定义类型通过ScanTableValue转换
+	if scanned, err := scanTableValue(obj, field, value); scanned || err != nil {
+		return err
+	}
+
+	format, isTime, err := getTimeFormat(obj, field)
+	if err != nil {
+		return err
+	}
+	if isTime {
+		t, err := format.decode(field, value)
+		if err != nil {
+			return err
+		}
+		switch {
+		case typ.Kind() == reflect.Ptr:
+			return reflections.SetField(obj, field, &t)
+		case typ == nullTimeType:
+			return reflections.SetField(obj, field, sql.NullTime{Time: t, Valid: true})
+		}
+		return reflections.SetField(obj, field, t)
+	}
+
+	//sql.Null*类型通过Scan()赋值，Scan会检查数字的范围
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		scanner := reflect.ValueOf(obj).Elem().FieldByName(field).Addr().Interface().(sql.Scanner)
+		if err := scanner.Scan(value); err != nil {
+			return fmt.Errorf("scan field %s error: %w", field, err)
+		}
+		return nil
+	}
+
+	//数字读出时为int64或float64，转换为字段的类型，指针字段按指向的类型转换
+	elemType := typ
+	if typ.Kind() == reflect.Ptr {
+		elemType = typ.Elem()
+	}
+	if isNumberKind(elemType.Kind()) {
+		value, err = toFieldNumber(field, value, elemType)
+		if err != nil {
+			return err
+		}
+	}
+	if typ.Kind() == reflect.Ptr {
+		v := reflect.ValueOf(value)
+		if !v.IsValid() || v.Type() != elemType {
+			return fmt.Errorf("field %s of type %s can not load from %T", field, typ, value)
+		}
+		ptr := reflect.New(elemType)
+		ptr.Elem().Set(v)
+		value = ptr.Interface()
+	}
+	return reflections.SetField(obj, field, value)
+}
+
+//列不存在时将字段置为零值，指针为nil，sql.Null*为无效
+func clearFieldValue(obj interface{}, field string) error {
+	typ, ok := getFieldType(obj, field)
+	if !ok {
+		return nil
+	}
+	return reflections.SetField(obj, field, reflect.Zero(typ).Interface())
+}
+
+//查询条件中的time.Time按字段的存储格式转换，模型中没有的字段使用默认格式，其他数字类型扩展为int64、float64
+//只处理范围查询和精确查询，返回转换后的副本，不修改传入的查询条件，调用方可以重复使用
+func convertQueryValues(obj interface{}, query search.Query) (search.Query, error) {
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	convert := func(column string, value interface{}) (interface{}, error) {
+		//自定义类型通过TableValue转换，包括方法定义在指针上的类型
+		if valuer, ok := asValuer(value); ok {
+			v, err := valuer.TableValue()
+			if err != nil {
+				return nil, err
+			}
+			value = v
+		}
+		t, ok := value.(time.Time)
+		if !ok {
+			return toColumnNumber(column, value)
+		}
+		format := DefaultTimeFormat
+		if field, ok := jsonToFieldMap[column]; ok {
+			fieldFormat, isTime, err := getTimeFormat(obj, field)
+			if err != nil {
+				return nil, err
+			}
+			if isTime {
+				format = fieldFormat
+			}
+		}
+		return format.encode(t), nil
+	}
+
+	return mapQuery(query, func(q search.Query) (search.Query, error) {
+		var err error
+		switch q := q.(type) {
+		case *search.RangeQuery:
+			copied := *q
+			if copied.From, err = convert(q.FieldName, q.From); err != nil {
+				return nil, err
+			}
+			if copied.To, err = convert(q.FieldName, q.To); err != nil {
+				return nil, err
+			}
+			return &copied, nil
+		case *search.TermQuery:
+			copied := *q
+			if copied.Term, err = convert(q.FieldName, q.Term); err != nil {
+				return nil, err
+			}
+			return &copied, nil
+		case *search.TermsQuery:
+			copied := *q
+			copied.Terms = make([]interface{}, len(q.Terms))
+			for i := range q.Terms {
+				if copied.Terms[i], err = convert(q.FieldName, q.Terms[i]); err != nil {
+					return nil, err
+				}
+			}
+			return &copied, nil
+		}
+		return q, nil
+	})
+}
+
+//复制查询条件，BoolQuery及其子查询列表会被复制，子查询由fn转换，fn不修改查询时可以直接返回原查询
+func mapQuery(query search.Query, fn func(search.Query) (search.Query, error)) (search.Query, error) {
+	boolQuery, ok := query.(*search.BoolQuery)
+	if !ok {
+		return fn(query)
+	}
+
+	copied := *boolQuery
+	for _, queries := range []*[]search.Query{&copied.MustQueries, &copied.MustNotQueries, &copied.FilterQueries, &copied.ShouldQueries} {
+		if *queries == nil {
+			continue
+		}
+		mapped := make([]search.Query, len(*queries))
+		for i, sub := range *queries {
+			var err error
+			if mapped[i], err = mapQuery(sub, fn); err != nil {
+				return nil, err
+			}
+		}
+		*queries = mapped
+	}
+	return &copied, nil
+}
@@ -0,0 +1,137 @@
+package tableorm
+
+import (
+	"database/sql"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"testing"
+	"time"
+)
+
+type nullableAccount struct {
+	ID       string          `json:"_id"`
+	Nickname *string         `json:"nickname"`
+	Age      *int32          `json:"age"`
+	Email    sql.NullString  `json:"email"`
+	Score    sql.NullFloat64 `json:"score"`
+	LoginAt  sql.NullTime    `json:"loginAt" tableorm:"timeFormat:second"`
+	Bio      string          `json:"bio,omitempty"`
+	Level    int64           `json:"level"`
+}
+
+func TestNullableColumnValue(t *testing.T) {
+	nickname := "bob"
+	age := int32(18)
+	login := time.Unix(1600000000, 0)
+	full := &nullableAccount{
+		ID:       "1",
+		Nickname: &nickname,
+		Age:      &age,
+		Email:    sql.NullString{String: "bob@example.com", Valid: true},
+		Score:    sql.NullFloat64{Float64: 1.5, Valid: true},
+		LoginAt:  sql.NullTime{Time: login, Valid: true},
+		Bio:      "hi",
+	}
+	want := map[string]interface{}{
+		"Nickname": "bob",
+		"Age":      int64(18),
+		"Email":    "bob@example.com",
+		"Score":    1.5,
+		"LoginAt":  int64(1600000000),
+		"Bio":      "hi",
+		"Level":    int64(0),
+	}
+	for field, wantValue := range want {
+		value, ok, err := getColumnValue(full, field)
+		if err != nil || !ok {
+			t.Fatalf("%s: getColumnValue() = %v, %v", field, ok, err)
+		}
+		if value != wantValue {
+			t.Errorf("%s: getColumnValue() = %v (%T), want %v (%T)", field, value, value, wantValue, wantValue)
+		}
+	}
+
+	for _, field := range []string{"Nickname", "Age", "Email", "Score", "LoginAt", "Bio"} {
+		_, ok, err := getColumnValue(&nullableAccount{}, field)
+		if err != nil {
+			t.Fatalf("%s: getColumnValue() error = %v", field, err)
+		}
+		if ok {
+			t.Errorf("%s: empty value should not be written", field)
+		}
+	}
+}
+
+func TestLoadDataNullableFields(t *testing.T) {
+	nickname := "old"
+	obj := &nullableAccount{
+		Nickname: &nickname,
+		Email:    sql.NullString{String: "old@example.com", Valid: true},
+		Bio:      "old",
+		Level:    3,
+	}
+
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("_id", "1")
+	row := &tablestore.Row{
+		PrimaryKey: pk,
+		Columns: []*tablestore.AttributeColumn{
+			{ColumnName: "age", Value: int64(20)},
+			{ColumnName: "score", Value: 2.5},
+			{ColumnName: "loginAt", Value: int64(1600000000)},
+		},
+	}
+	if err := LoadData(obj, row); err != nil {
+		t.Fatal(err)
+	}
+
+	if obj.ID != "1" {
+		t.Errorf("ID = %q", obj.ID)
+	}
+	if obj.Age == nil || *obj.Age != 20 {
+		t.Errorf("Age = %v", obj.Age)
+	}
+	if !obj.Score.Valid || obj.Score.Float64 != 2.5 {
+		t.Errorf("Score = %v", obj.Score)
+	}
+	if !obj.LoginAt.Valid || !obj.LoginAt.Time.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("LoginAt = %v", obj.LoginAt)
+	}
+	//行中没有的可以为空的字段被清空，其余字段保持不变
+	if obj.Nickname != nil || obj.Email.Valid || obj.Bio != "" {
+		t.Errorf("missing nullable columns should be cleared, got %v %v %q", obj.Nickname, obj.Email, obj.Bio)
+	}
+	if obj.Level != 3 {
+		t.Errorf("Level = %d, non nullable field should be kept", obj.Level)
+	}
+}
+
+func TestSetFieldValuePointerTypeMismatch(t *testing.T) {
+	if err := setFieldValue(&nullableAccount{}, "Nickname", int64(1)); err == nil {
+		t.Error("loading int64 into *string should return error")
+	}
+}
+
+func TestCreateIndexSchemaNullableFields(t *testing.T) {
+	schemas, err := CreateIndexSchema(&nullableAccount{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]tablestore.FieldType{
+		"nickname": tablestore.FieldType_KEYWORD,
+		"age":      tablestore.FieldType_LONG,
+		"email":    tablestore.FieldType_KEYWORD,
+		"score":    tablestore.FieldType_DOUBLE,
+		"loginAt":  tablestore.FieldType_LONG,
+		"bio":      tablestore.FieldType_KEYWORD,
+		"level":    tablestore.FieldType_LONG,
+	}
+	got := map[string]tablestore.FieldType{}
+	for _, schema := range schemas {
+		got[*schema.FieldName] = schema.FieldType
+	}
+	for name, fieldType := range want {
+		if got[name] != fieldType {
+			t.Errorf("%s: field type = %v, want %v", name, got[name], fieldType)
+		}
+	}
+}
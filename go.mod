@@ -3,7 +3,7 @@ module github.com/diemus/tableorm
 go 1.14
 
 require (
-	github.com/aliyun/aliyun-tablestore-go-sdk v1.5.0
+	github.com/aliyun/aliyun-tablestore-go-sdk v1.7.3
 	github.com/golang/protobuf v1.4.0
 	github.com/oleiade/reflections v1.0.0
 	github.com/satori/go.uuid v1.2.0
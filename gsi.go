@@ -0,0 +1,448 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/oleiade/reflections"
+	"log"
+	"reflect"
+	"strings"
+)
+
+//全局二级索引，通过 gsi:"email_idx" 声明，同一索引的多个字段按字段定义顺序组成索引主键
+//一个字段属于多个索引时用逗号分隔，例如 gsi:"email_idx,email_age_idx"
+//TableStore会自动将主表主键追加到索引主键之后，索引中不冗余其他列，读取时回查主表
+type secondaryIndex struct {
+	Name    string
+	Columns []string
+}
+
+func getSecondaryIndexes(obj interface{}) ([]*secondaryIndex, error) {
+	fieldToJSONMap, _, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := getModelFieldNames(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	pkColumns := map[string]bool{}
+	for _, pkField := range pkFields {
+		pkColumns[pkField.Column] = true
+	}
+
+	indexes := []*secondaryIndex{}
+	indexMap := map[string]*secondaryIndex{}
+	for _, field := range fields {
+		tag, _ := reflections.GetFieldTag(obj, field, "gsi")
+		if tag == "" {
+			continue
+		}
+
+		column := fieldToJSONMap[field]
+		if column == "" {
+			return nil, fmt.Errorf("secondary index field %s must have json tag", field)
+		}
+		if pkColumns[column] {
+			return nil, fmt.Errorf("secondary index field %s can not be primary key", field)
+		}
+		if _, err := getDefinedColumnType(obj, field); err != nil {
+			return nil, err
+		}
+
+		for _, name := range strings.Split(tag, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			index, ok := indexMap[name]
+			if !ok {
+				index = &secondaryIndex{Name: name}
+				indexMap[name] = index
+				indexes = append(indexes, index)
+			}
+			index.Columns = append(index.Columns, column)
+		}
+	}
+	return indexes, nil
+}
+
+//TableStore要求有二级索引的主表数据永不过期且只保留一个版本，否则创建索引失败
+func checkSecondaryIndexTableOptions(obj interface{}) error {
+	indexes, err := getSecondaryIndexes(obj)
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+
+	options, err := GetTableOptions(obj)
+	if err != nil {
+		return err
+	}
+	if options.TimeToAlive != -1 || options.MaxVersion != 1 {
+		return fmt.Errorf("secondary index %s requires ttl -1 and maxVersion 1, %s has ttl %d and maxVersion %d",
+			indexes[0].Name, reflect.Indirect(reflect.ValueOf(obj)).Type(), options.TimeToAlive, options.MaxVersion)
+	}
+	return nil
+}
+
+//索引主键只支持string、int64、[]byte
+func getDefinedColumnType(obj interface{}, field string) (tablestore.DefinedColumnType, error) {
+	value, err := reflections.GetField(obj, field)
+	if err != nil {
+		return 0, err
+	}
+
+	switch value.(type) {
+	case string:
+		return tablestore.DefinedColumn_STRING, nil
+	case int64:
+		return tablestore.DefinedColumn_INTEGER, nil
+	case []byte:
+		return tablestore.DefinedColumn_BINARY, nil
+	default:
+		return 0, fmt.Errorf("secondary index field %s must be one of (string,int64,[]byte), it's %T now", field, value)
+	}
+}
+
+func (db *DB) getSecondaryIndex(obj interface{}, indexName string) (*secondaryIndex, error) {
+	indexes, err := getSecondaryIndexes(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if index.Name == indexName {
+			return index, nil
+		}
+	}
+	return nil, fmt.Errorf("secondary index %s not defined in table %s", indexName, db.tableName(obj))
+}
+
+//指定下一次Get或GetRange使用的全局二级索引
+func (db *DB) UseIndex(indexName string) *DB {
+	db.secondaryIndex = indexName
+	return db
+}
+
+//通过二级索引读取，obj中需要设置索引列的值，存在多行时返回索引中的第一行
+func (db *DB) getByIndex(obj interface{}, indexName string) error {
+	index, err := db.getSecondaryIndex(obj, indexName)
+	if err != nil {
+		return err
+	}
+
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return err
+	}
+
+	values := []interface{}{}
+	for _, column := range index.Columns {
+		value, err := reflections.GetField(obj, jsonToFieldMap[column])
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+
+	rows, err := db.getIndexRange(obj, index, values, values, 1)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return NotResultFound
+	}
+
+	//索引行的主键包含主表主键，填充后按主键回查主表
+	pk, err := mainPrimaryKey(obj, rows[0])
+	if err != nil {
+		return err
+	}
+	if err := loadPrimaryKey(obj, pk); err != nil {
+		return err
+	}
+	return db.get(obj, nil)
+}
+
+//从索引行的主键中取出主表主键，按主表主键顺序排列
+func mainPrimaryKey(obj interface{}, row *tablestore.Row) (*tablestore.PrimaryKey, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for _, column := range row.PrimaryKey.PrimaryKeys {
+		values[column.ColumnName] = column.Value
+	}
+
+	pk := new(tablestore.PrimaryKey)
+	for _, pkField := range pkFields {
+		value, ok := values[pkField.Column]
+		if !ok {
+			return nil, fmt.Errorf("primary key %s not found in index row", pkField.Column)
+		}
+		pk.AddPrimaryKeyColumn(pkField.Column, value)
+	}
+	return pk, nil
+}
+
+//通过二级索引范围读取，范围为[start, end)，start、end为索引列的值，多列索引时可以是按顺序排列的前缀[]interface{}
+//start包含以start为前缀的行，end不包含以end为前缀的行，为nil时不限制，可以通过Limit限制行数
+func (db *DB) GetRange(obj interface{}, start, end interface{}) error {
+	indexName := db.secondaryIndex
+	limit := db.limit
+	db.reset()
+	if indexName == "" {
+		return fmt.Errorf("GetRange requires UseIndex")
+	}
+
+	typ := reflect.TypeOf(obj)
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("not a slice pointer")
+	}
+	model := reflect.New(typ.Elem().Elem()).Interface()
+
+	index, err := db.getSecondaryIndex(model, indexName)
+	if err != nil {
+		return err
+	}
+
+	toValues := func(value interface{}) []interface{} {
+		if value == nil {
+			return nil
+		}
+		if values, ok := value.([]interface{}); ok {
+			return values
+		}
+		return []interface{}{value}
+	}
+	rows, err := db.getIndexRange(model, index, toValues(start), toValues(end), limit)
+	if err != nil {
+		return err
+	}
+
+	//按索引顺序回查主表
+	ids := []interface{}{}
+	for _, row := range rows {
+		item := reflect.New(typ.Elem().Elem()).Interface()
+		pk, err := mainPrimaryKey(item, row)
+		if err != nil {
+			return err
+		}
+		if err := loadPrimaryKey(item, pk); err != nil {
+			return err
+		}
+		values, err := GetPrimaryKeyValues(item)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, values)
+	}
+	return db.FindByIDs(obj, ids...)
+}
+
+//读取索引表，start、end为索引列的前缀值，end为空时读到最后，limit小于等于0时读取全部
+//start、end相同时读取等于该值的所有行
+func (db *DB) getIndexRange(obj interface{}, index *secondaryIndex, start, end []interface{}, limit int) ([]*tablestore.Row, error) {
+	if len(start) > len(index.Columns) || len(end) > len(index.Columns) {
+		return nil, fmt.Errorf("secondary index %s has %d columns", index.Name, len(index.Columns))
+	}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	columns := append([]string{}, index.Columns...)
+	for _, pkField := range pkFields {
+		columns = append(columns, pkField.Column)
+	}
+
+	//相同前缀时结束位置为前缀之后的最大值，包含所有等于前缀的行
+	inclusiveEnd := end != nil && reflect.DeepEqual(start, end)
+	startPK := new(tablestore.PrimaryKey)
+	endPK := new(tablestore.PrimaryKey)
+	for i, column := range columns {
+		if i < len(start) {
+			startPK.AddPrimaryKeyColumn(column, toPrimaryKeyValue(start[i]))
+		} else {
+			startPK.AddPrimaryKeyColumnWithMinValue(column)
+		}
+
+		switch {
+		case i < len(end):
+			endPK.AddPrimaryKeyColumn(column, toPrimaryKeyValue(end[i]))
+		case end == nil || inclusiveEnd:
+			endPK.AddPrimaryKeyColumnWithMaxValue(column)
+		default:
+			endPK.AddPrimaryKeyColumnWithMinValue(column)
+		}
+	}
+
+	rows := []*tablestore.Row{}
+	for startPK != nil {
+		criteria := &tablestore.RangeRowQueryCriteria{
+			TableName:       index.Name,
+			StartPrimaryKey: startPK,
+			EndPrimaryKey:   endPK,
+			Direction:       tablestore.FORWARD,
+			MaxVersion:      1,
+		}
+		if limit > 0 {
+			criteria.Limit = int32(limit - len(rows))
+		}
+
+		resp, err := db.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Rows...)
+		if limit > 0 && len(rows) >= limit {
+			break
+		}
+		startPK = resp.NextStartPrimaryKey
+	}
+	return rows, nil
+}
+
+//创建缺少的二级索引，返回新创建的索引名
+//索引列需要先声明为主表的预定义列，已有索引的主键与定义不一致时返回错误，需要手动删除后重建
+func (db *DB) syncSecondaryIndexes(obj interface{}) ([]string, error) {
+	indexes, err := getSecondaryIndexes(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	tableName := db.tableName(obj)
+	resp, err := db.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: tableName})
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := missingDefinedColumns(obj, resp.TableMeta, indexes)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		log.Printf("add defined columns to table %s", tableName)
+		_, err := db.client.AddDefinedColumn(&tablestore.AddDefinedColumnRequest{
+			TableName:      tableName,
+			DefinedColumns: missing,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	created := []string{}
+	for _, index := range indexes {
+		exist, err := secondaryIndexExist(resp.IndexMetas, index)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			log.Printf("secondary index %s already exist", index.Name)
+			continue
+		}
+
+		log.Printf("create secondary index %s", index.Name)
+		_, err = db.client.CreateIndex(&tablestore.CreateIndexRequest{
+			MainTableName: tableName,
+			IndexMeta: &tablestore.IndexMeta{
+				IndexName:  index.Name,
+				Primarykey: index.Columns,
+				IndexType:  tablestore.IT_GLOBAL_INDEX,
+			},
+			//同步已有数据
+			IncludeBaseData: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, index.Name)
+	}
+	return created, nil
+}
+
+//索引列中还没有声明为预定义列的列
+func missingDefinedColumns(obj interface{}, tableMeta *tablestore.TableMeta, indexes []*secondaryIndex) ([]*tablestore.DefinedColumnSchema, error) {
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	defined := map[string]bool{}
+	for _, column := range tableMeta.DefinedColumns {
+		defined[column.Name] = true
+	}
+
+	missing := []*tablestore.DefinedColumnSchema{}
+	for _, index := range indexes {
+		for _, column := range index.Columns {
+			if defined[column] {
+				continue
+			}
+			columnType, err := getDefinedColumnType(obj, jsonToFieldMap[column])
+			if err != nil {
+				return nil, err
+			}
+			missing = append(missing, &tablestore.DefinedColumnSchema{Name: column, ColumnType: columnType})
+			defined[column] = true
+		}
+	}
+	return missing, nil
+}
+
+//已有索引的主键以主表主键结尾，只对比索引列部分
+func secondaryIndexExist(indexMetas []*tablestore.IndexMeta, index *secondaryIndex) (bool, error) {
+	for _, meta := range indexMetas {
+		if meta.IndexName != index.Name {
+			continue
+		}
+		if len(meta.Primarykey) < len(index.Columns) || !reflect.DeepEqual(meta.Primarykey[:len(index.Columns)], index.Columns) {
+			return false, fmt.Errorf("secondary index %s primary key %v not match %v, delete it manually to recreate", index.Name, meta.Primarykey, index.Columns)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+//需要创建的二级索引，用于生成迁移计划
+func (db *DB) planSecondaryIndexes(obj interface{}, tableExist bool) ([]string, error) {
+	indexes, err := getSecondaryIndexes(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	indexMetas := []*tablestore.IndexMeta{}
+	if tableExist {
+		resp, err := db.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: db.tableName(obj)})
+		if err != nil {
+			return nil, err
+		}
+		indexMetas = resp.IndexMetas
+	}
+
+	names := []string{}
+	for _, index := range indexes {
+		exist, err := secondaryIndexExist(indexMetas, index)
+		if err != nil {
+			return nil, err
+		}
+		if !exist {
+			names = append(names, index.Name)
+		}
+	}
+	return names, nil
+}
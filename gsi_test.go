@@ -0,0 +1,168 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+	"testing"
+)
+
+type gsiUser struct {
+	ID    string `json:"_id"`
+	Email string `json:"email" gsi:"email_idx,email_age_idx"`
+	Age   int64  `json:"age" gsi:"email_age_idx"`
+	Name  string `json:"name"`
+}
+
+func TestGetSecondaryIndexes(t *testing.T) {
+	indexes, err := getSecondaryIndexes(&gsiUser{})
+	if err != nil {
+		t.Fatalf("getSecondaryIndexes() error = %v", err)
+	}
+	want := []*secondaryIndex{
+		{Name: "email_idx", Columns: []string{"email"}},
+		{Name: "email_age_idx", Columns: []string{"email", "age"}},
+	}
+	if !reflect.DeepEqual(indexes, want) {
+		t.Errorf("getSecondaryIndexes() = %v, want %v", indexes, want)
+	}
+}
+
+func TestGetSecondaryIndexesError(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+	}{
+		{"primary key", &struct {
+			ID string `json:"_id" gsi:"id_idx"`
+		}{}},
+		{"float column", &struct {
+			ID    string  `json:"_id"`
+			Score float64 `json:"score" gsi:"score_idx"`
+		}{}},
+		{"without json tag", &struct {
+			ID    string `json:"_id"`
+			Email string `gsi:"email_idx"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := getSecondaryIndexes(tt.obj); err == nil {
+				t.Error("getSecondaryIndexes() expected error")
+			}
+		})
+	}
+}
+
+type gsiTTLUser struct {
+	ID    string `json:"_id" tableorm:"ttl:86400"`
+	Email string `json:"email" gsi:"email_idx"`
+}
+
+type gsiVersionUser struct {
+	ID    string `json:"_id" tableorm:"maxVersion:3"`
+	Email string `json:"email" gsi:"email_idx"`
+}
+
+type ttlUser struct {
+	ID    string `json:"_id" tableorm:"ttl:86400;maxVersion:3"`
+	Email string `json:"email"`
+}
+
+func TestCheckSecondaryIndexTableOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     interface{}
+		wantErr bool
+	}{
+		{"default options", &gsiUser{}, false},
+		{"without secondary index", &ttlUser{}, false},
+		{"ttl", &gsiTTLUser{}, true},
+		{"max version", &gsiVersionUser{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSecondaryIndexTableOptions(tt.obj)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSecondaryIndexTableOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := CheckModel(tt.obj); (err != nil) != tt.wantErr {
+				t.Errorf("CheckModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecondaryIndexExist(t *testing.T) {
+	index := &secondaryIndex{Name: "email_age_idx", Columns: []string{"email", "age"}}
+	tests := []struct {
+		name    string
+		metas   []*tablestore.IndexMeta
+		want    bool
+		wantErr bool
+	}{
+		{"missing", []*tablestore.IndexMeta{{IndexName: "email_idx", Primarykey: []string{"email", "_id"}}}, false, false},
+		{"exist", []*tablestore.IndexMeta{{IndexName: "email_age_idx", Primarykey: []string{"email", "age", "_id"}}}, true, false},
+		{"columns changed", []*tablestore.IndexMeta{{IndexName: "email_age_idx", Primarykey: []string{"age", "email", "_id"}}}, false, true},
+		{"fewer columns", []*tablestore.IndexMeta{{IndexName: "email_age_idx", Primarykey: []string{"email"}}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secondaryIndexExist(tt.metas, index)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("secondaryIndexExist() = %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+//表不存在时所有二级索引都需要创建，不需要访问服务端
+func TestPlanSecondaryIndexesNewTable(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	names, err := db.planSecondaryIndexes(&gsiUser{}, false)
+	if err != nil {
+		t.Fatalf("planSecondaryIndexes() error = %v", err)
+	}
+	if want := []string{"email_idx", "email_age_idx"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("planSecondaryIndexes() = %v, want %v", names, want)
+	}
+
+	names, err = db.planSecondaryIndexes(&plainUser{}, true)
+	if err != nil || names != nil {
+		t.Errorf("planSecondaryIndexes() without gsi = %v, %v, want nil", names, err)
+	}
+}
+
+func TestMissingDefinedColumns(t *testing.T) {
+	indexes, err := getSecondaryIndexes(&gsiUser{})
+	if err != nil {
+		t.Fatalf("getSecondaryIndexes() error = %v", err)
+	}
+	tableMeta := &tablestore.TableMeta{DefinedColumns: []*tablestore.DefinedColumnSchema{{Name: "email", ColumnType: tablestore.DefinedColumn_STRING}}}
+
+	missing, err := missingDefinedColumns(&gsiUser{}, tableMeta, indexes)
+	if err != nil {
+		t.Fatalf("missingDefinedColumns() error = %v", err)
+	}
+	want := []*tablestore.DefinedColumnSchema{{Name: "age", ColumnType: tablestore.DefinedColumn_INTEGER}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("missingDefinedColumns() = %v, want %v", missing, want)
+	}
+}
+
+func TestMainPrimaryKey(t *testing.T) {
+	indexPK := new(tablestore.PrimaryKey)
+	indexPK.AddPrimaryKeyColumn("email", "a@b.c")
+	indexPK.AddPrimaryKeyColumn("_id", "user-1")
+
+	pk, err := mainPrimaryKey(&gsiUser{}, &tablestore.Row{PrimaryKey: indexPK})
+	if err != nil {
+		t.Fatalf("mainPrimaryKey() error = %v", err)
+	}
+	if len(pk.PrimaryKeys) != 1 || pk.PrimaryKeys[0].ColumnName != "_id" || pk.PrimaryKeys[0].Value != "user-1" {
+		t.Errorf("mainPrimaryKey() = %v, want _id=user-1", pk.PrimaryKeys)
+	}
+
+	if _, err := mainPrimaryKey(&hashPrefixEvent{}, &tablestore.Row{PrimaryKey: indexPK}); err == nil {
+		t.Error("mainPrimaryKey() expected error for missing primary key column")
+	}
+}
@@ -0,0 +1,190 @@
+package tableorm
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/oleiade/reflections"
+	uuid "github.com/satori/go.uuid"
+	"sync"
+	"time"
+)
+
+//ID生成器，_id为空时用于生成ID
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+//模型可以实现该接口来指定自己的ID生成器，优先级高于tag
+type IDGeneratorProvider interface {
+	IDGenerator() IDGenerator
+}
+
+//全局默认的ID生成器
+var DefaultIDGenerator IDGenerator = UUIDGenerator{}
+
+//可以在主键字段上通过tag指定的生成器，例如 tableorm:"idGenerator:ulid"
+var idGenerators = map[string]IDGenerator{
+	"uuid":          UUIDGenerator{},
+	"uuidv7":        UUIDv7Generator{},
+	"ulid":          ULIDGenerator{},
+	"snowflake":     NewSnowflakeGenerator(0),
+	"autoIncrement": AutoIncrementGenerator{},
+}
+
+//注册自定义的ID生成器，注册后可以在tag中通过name使用
+func RegisterIDGenerator(name string, generator IDGenerator) {
+	idGenerators[name] = generator
+}
+
+//获取模型的ID生成器，即第一个需要生成值的主键列的生成器，没有时返回nil
+func GetIDGenerator(obj interface{}) (IDGenerator, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkField := range pkFields {
+		if pkField.Generator != nil {
+			return pkField.Generator, nil
+		}
+	}
+	return nil, nil
+}
+
+//获取主键列的ID生成器
+//_id的优先级为 模型方法 > tag > 全局默认，其余主键列只有通过tag指定时才会自动生成
+func getFieldIDGenerator(obj interface{}, pkField *primaryKeyField) (IDGenerator, error) {
+	if provider, ok := obj.(IDGeneratorProvider); ok && pkField.Column == "_id" {
+		return provider.IDGenerator(), nil
+	}
+
+	tag, _ := reflections.GetFieldTag(obj, pkField.Field, "tableorm")
+	name, ok := parseTableormTag(tag)["idGenerator"]
+	if !ok {
+		if pkField.Column == "_id" {
+			return DefaultIDGenerator, nil
+		}
+		return nil, nil
+	}
+
+	generator, ok := idGenerators[name]
+	if !ok {
+		return nil, fmt.Errorf("unexpected id generator %s %s", pkField.Field, name)
+	}
+	return generator, nil
+}
+
+func isAutoIncrement(generator IDGenerator) bool {
+	_, ok := generator.(AutoIncrementGenerator)
+	return ok
+}
+
+//随机UUID，无序
+type UUIDGenerator struct{}
+
+func (UUIDGenerator) NewID() (string, error) {
+	return uuid.NewV4().String(), nil
+}
+
+//按时间排序的UUID，前48位为毫秒时间戳，其余为随机数
+type UUIDv7Generator struct{}
+
+func (UUIDv7Generator) NewID() (string, error) {
+	var id uuid.UUID
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(id[:6], ts[2:])
+
+	//版本号7，变体为RFC4122
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	return id.String(), nil
+}
+
+//ULID，26位Crockford Base32，前48位为毫秒时间戳，按字符串排序即按时间排序
+type ULIDGenerator struct{}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (ULIDGenerator) NewID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(id[:6], ts[2:])
+
+	//128位数据编码为26个字符，每个字符5位，最高位补2个0
+	out := make([]byte, 26)
+	for i := range out {
+		var v byte
+		for bit := i*5 - 2; bit < i*5+3; bit++ {
+			v <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockfordBase32[v]
+	}
+	return string(out), nil
+}
+
+//雪花算法，41位毫秒时间戳 + 10位节点ID + 12位序列号
+//输出补0到19位的十进制字符串，保证按字符串排序即按时间排序
+type SnowflakeGenerator struct {
+	nodeID   int64
+	mu       sync.Mutex
+	lastTime int64
+	sequence int64
+}
+
+//起始时间 2020-01-01 00:00:00 UTC，单位毫秒
+const snowflakeEpoch = 1577836800000
+
+//nodeID范围为0-1023，多实例部署时每个实例需要不同的nodeID，否则可能生成重复ID
+func NewSnowflakeGenerator(nodeID int64) *SnowflakeGenerator {
+	return &SnowflakeGenerator{nodeID: nodeID & 0x3ff}
+}
+
+func (g *SnowflakeGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now < g.lastTime {
+		return "", fmt.Errorf("clock moved backwards, refusing to generate id for %d ms", g.lastTime-now)
+	}
+
+	if now == g.lastTime {
+		g.sequence = (g.sequence + 1) & 0xfff
+		//同一毫秒内序列号用完，等到下一毫秒
+		if g.sequence == 0 {
+			for now <= g.lastTime {
+				now = time.Now().UnixNano() / int64(time.Millisecond)
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTime = now
+
+	id := (now-snowflakeEpoch)<<22 | g.nodeID<<12 | g.sequence
+	return fmt.Sprintf("%019d", id), nil
+}
+
+//由TableStore服务端生成自增ID，字段必须为int64，Save后会回填到结构体中
+//TableStore要求自增列不能是分区键，因此只能用于复合主键中除第一列以外的主键列
+type AutoIncrementGenerator struct{}
+
+func (AutoIncrementGenerator) NewID() (string, error) {
+	return "", fmt.Errorf("auto increment id is generated by TableStore")
+}
@@ -0,0 +1,164 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+	"testing"
+)
+
+type idDefaultModel struct {
+	ID string `json:"_id"`
+}
+
+type idTagModel struct {
+	ID string `json:"_id" tableorm:"idGenerator:ulid"`
+}
+
+type idUnknownTagModel struct {
+	ID string `json:"_id" tableorm:"idGenerator:unknown"`
+}
+
+type idAutoIncrementModel struct {
+	Tenant string `json:"tenant" pk:"1"`
+	Seq    int64  `json:"seq" pk:"2" tableorm:"idGenerator:autoIncrement"`
+	Name   string `json:"name"`
+}
+
+type fixedIDGenerator string
+
+func (g fixedIDGenerator) NewID() (string, error) {
+	return string(g), nil
+}
+
+//接口优先级高于tag
+type idProviderModel struct {
+	ID string `json:"_id" tableorm:"idGenerator:ulid"`
+}
+
+func (idProviderModel) IDGenerator() IDGenerator {
+	return fixedIDGenerator("fixed")
+}
+
+func TestGetIDGenerator(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+		want IDGenerator
+	}{
+		{"default", &idDefaultModel{}, DefaultIDGenerator},
+		{"tag", &idTagModel{}, ULIDGenerator{}},
+		{"auto increment", &idAutoIncrementModel{}, AutoIncrementGenerator{}},
+		{"provider", &idProviderModel{}, fixedIDGenerator("fixed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetIDGenerator(tt.obj)
+			if err != nil {
+				t.Fatalf("GetIDGenerator() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetIDGenerator() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := GetIDGenerator(&idUnknownTagModel{}); err == nil {
+		t.Error("GetIDGenerator() should reject unknown generator")
+	}
+}
+
+func TestRegisterIDGenerator(t *testing.T) {
+	RegisterIDGenerator("testFixed", fixedIDGenerator("registered"))
+	defer delete(idGenerators, "testFixed")
+
+	obj := &struct {
+		ID string `json:"_id" tableorm:"idGenerator:testFixed"`
+	}{}
+	id, err := EnsureID(obj)
+	if err != nil {
+		t.Fatalf("EnsureID() error = %v", err)
+	}
+	if id != "registered" || obj.ID != "registered" {
+		t.Errorf("EnsureID() = %q, obj.ID = %q, want registered", id, obj.ID)
+	}
+}
+
+func TestEnsureIDUsesProvider(t *testing.T) {
+	obj := &idProviderModel{}
+	if _, err := EnsureID(obj); err != nil {
+		t.Fatalf("EnsureID() error = %v", err)
+	}
+	if obj.ID != "fixed" {
+		t.Errorf("EnsureID() set %q, want fixed", obj.ID)
+	}
+
+	obj = &idProviderModel{ID: "kept"}
+	if _, err := EnsureID(obj); err != nil {
+		t.Fatalf("EnsureID() error = %v", err)
+	}
+	if obj.ID != "kept" {
+		t.Errorf("EnsureID() overwrote ID to %q", obj.ID)
+	}
+}
+
+func TestIDGeneratorsFormat(t *testing.T) {
+	ulid, _ := ULIDGenerator{}.NewID()
+	if len(ulid) != 26 || strings.Trim(ulid, crockfordBase32) != "" {
+		t.Errorf("ULIDGenerator.NewID() = %q, want 26 Crockford Base32 chars", ulid)
+	}
+
+	uuidv7, _ := UUIDv7Generator{}.NewID()
+	if len(uuidv7) != 36 || uuidv7[14] != '7' {
+		t.Errorf("UUIDv7Generator.NewID() = %q, want version 7", uuidv7)
+	}
+
+	generator := NewSnowflakeGenerator(1)
+	last := ""
+	for i := 0; i < 1000; i++ {
+		id, err := generator.NewID()
+		if err != nil {
+			t.Fatalf("SnowflakeGenerator.NewID() error = %v", err)
+		}
+		if len(id) != 19 || id <= last {
+			t.Fatalf("SnowflakeGenerator.NewID() = %q after %q, want increasing 19 digits", id, last)
+		}
+		last = id
+	}
+}
+
+func TestAutoIncrementRowChange(t *testing.T) {
+	rowChange, err := GetSaveRowChange(&idAutoIncrementModel{Tenant: "a", Name: "a"})
+	if err != nil {
+		t.Fatalf("GetSaveRowChange() error = %v", err)
+	}
+	if rowChange.ReturnType != tablestore.ReturnType_RT_PK {
+		t.Errorf("ReturnType = %v, want RT_PK", rowChange.ReturnType)
+	}
+	pk := rowChange.PrimaryKey.PrimaryKeys[1]
+	if pk.ColumnName != "seq" || pk.PrimaryKeyOption != tablestore.AUTO_INCREMENT {
+		t.Errorf("primary key = %+v, want auto increment seq", pk)
+	}
+
+	rowChange, err = GetSaveRowChange(&idAutoIncrementModel{Tenant: "a", Seq: 7, Name: "a"})
+	if err != nil {
+		t.Fatalf("GetSaveRowChange() error = %v", err)
+	}
+	if rowChange.ReturnType == tablestore.ReturnType_RT_PK {
+		t.Error("ReturnType should not be RT_PK when ID is set")
+	}
+}
+
+//PutRow返回的主键回填到结构体
+func TestAutoIncrementReadBack(t *testing.T) {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("tenant", "a")
+	pk.AddPrimaryKeyColumn("seq", int64(42))
+
+	obj := &idAutoIncrementModel{Tenant: "a", Name: "a"}
+	if err := LoadData(obj, &tablestore.Row{PrimaryKey: pk}); err != nil {
+		t.Fatalf("LoadData() error = %v", err)
+	}
+	if obj.Seq != 42 || obj.Name != "a" {
+		t.Errorf("LoadData() = %+v, want Seq 42 and Name kept", obj)
+	}
+}
@@ -0,0 +1,462 @@
+package tableorm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"log"
+	"sync"
+	"time"
+)
+
+//迁移相关配置
+type MigrateOptions struct {
+	//索引重建后保留旧索引，用于RollbackIndex回滚，需要手动调用DropPreviousIndex删除
+	//不保留时旧索引在其他实例的别名缓存过期后于后台删除，删除前仍可回滚
+	KeepPreviousIndex bool
+	//等待新索引同步完成的超时时间，也是等待其他实例重建同一张表索引的超时时间，默认1小时
+	IndexSyncTimeout time.Duration
+	//AutoMigrate新建索引后等待同步完成再返回，重建索引时总是会等待
+	WaitIndexReady bool
+	//等待索引同步时的进度回调，为空时记录日志
+	OnIndexProgress func(progress *IndexSyncProgress)
+	//版本化迁移的锁超时时间，执行期间每隔三分之一的超时时间续期一次，默认30分钟
+	LockTimeout time.Duration
+}
+
+func (db *DB) SetMigrateOptions(options MigrateOptions) *DB {
+	db.migrateOptions = options
+	return db
+}
+
+//索引别名，记录每张表当前使用的多元索引，所有实例查询时都读取这里，保证同时切换
+//索引schema变化时先创建新版本的索引，同步完成后再切换别名，切换前查询不受影响
+type indexAlias struct {
+	//表名
+	ID string `json:"_id"`
+	//当前使用的索引
+	Active string `json:"active"`
+	//切换前使用的索引，用于回滚，已删除时为空
+	Previous string `json:"previous"`
+	//被替换下来等待删除的索引，JSON数组，见retiredIndex
+	Retired string `json:"retired"`
+	//当前索引的版本，第一个版本为不带后缀的 表名_index
+	Version   int64 `json:"version"`
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
+//等待删除的旧索引，其他实例的别名缓存过期后才能删除，防止还在使用旧索引的查询失败
+//记录在别名中，到期后由后台任务删除，进程提前退出时由之后的AutoMigrate或DropPreviousIndex删除，不会遗漏
+type retiredIndex struct {
+	Index string `json:"index"`
+	//可以删除的时间，秒
+	DropAfter int64 `json:"dropAfter"`
+}
+
+func (a *indexAlias) retiredIndexes() ([]retiredIndex, error) {
+	list := []retiredIndex{}
+	if a.Retired == "" {
+		return list, nil
+	}
+	if err := json.Unmarshal([]byte(a.Retired), &list); err != nil {
+		return nil, fmt.Errorf("parse retired indexes of table %s error: %w", a.ID, err)
+	}
+	return list, nil
+}
+
+func (a *indexAlias) setRetiredIndexes(list []retiredIndex) error {
+	if len(list) == 0 {
+		a.Retired = ""
+		return nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	a.Retired = string(data)
+	return nil
+}
+
+//将索引加入等待删除的列表，已在列表中时取较晚的删除时间
+func retireIndex(list []retiredIndex, indexName string, dropAfter time.Time) []retiredIndex {
+	if indexName == "" {
+		return list
+	}
+	for i := range list {
+		if list[i].Index == indexName {
+			if dropAfter.Unix() > list[i].DropAfter {
+				list[i].DropAfter = dropAfter.Unix()
+			}
+			return list
+		}
+	}
+	return append(list, retiredIndex{Index: indexName, DropAfter: dropAfter.Unix()})
+}
+
+//到期可以删除的索引，回滚后重新使用的当前索引不会被删除，从列表中移除
+func dueRetiredIndexes(list []retiredIndex, now time.Time, active string) (due []string, remaining []retiredIndex) {
+	remaining = []retiredIndex{}
+	for _, retired := range list {
+		switch {
+		case retired.Index == active:
+		case retired.DropAfter <= now.Unix():
+			due = append(due, retired.Index)
+		default:
+			remaining = append(remaining, retired)
+		}
+	}
+	return due, remaining
+}
+
+func (indexAlias) TableName() string {
+	return "tableorm_index_alias"
+}
+
+//索引别名的缓存时间，超过后重新读取，其他实例切换索引后最多延迟这么久生效
+const indexAliasCacheTTL = time.Minute
+
+//缓存每张表当前使用的索引名，避免每次查询都读取别名表
+type indexAliasCache struct {
+	mu      sync.Mutex
+	entries map[string]indexAliasCacheEntry
+}
+
+type indexAliasCacheEntry struct {
+	indexName string
+	expireAt  time.Time
+}
+
+func newIndexAliasCache() *indexAliasCache {
+	return &indexAliasCache{entries: map[string]indexAliasCacheEntry{}}
+}
+
+func (c *indexAliasCache) get(tableName string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[tableName]
+	if !ok || time.Now().After(entry.expireAt) {
+		return "", false
+	}
+	return entry.indexName, true
+}
+
+func (c *indexAliasCache) set(tableName, indexName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[tableName] = indexAliasCacheEntry{
+		indexName: indexName,
+		expireAt:  time.Now().Add(indexAliasCacheTTL),
+	}
+}
+
+func (c *indexAliasCache) delete(tableName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, tableName)
+}
+
+//读取别名，不存在时返回nil，别名表不存在时也视为不存在
+func (db *DB) getIndexAlias(obj interface{}) (*indexAlias, error) {
+	//不经过Get，后台删除旧索引时不影响调用方正在构造的查询
+	alias := &indexAlias{ID: db.tableName(obj)}
+	err := db.get(alias, nil)
+	if err == NotResultFound || isObjectNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+func (db *DB) saveIndexAlias(alias *indexAlias) error {
+	if err := db.ensureTable(alias); err != nil {
+		return err
+	}
+
+	alias.UpdatedAt = time.Now().Unix()
+	_, err := db.Save(alias)
+	if err != nil {
+		return err
+	}
+
+	db.indexAliases.delete(alias.ID)
+	return nil
+}
+
+//当前使用的索引名，没有别名时为命名规则生成的索引名
+func (db *DB) activeIndexName(obj interface{}) (string, error) {
+	tableName := db.tableName(obj)
+	if indexName, ok := db.indexAliases.get(tableName); ok {
+		return indexName, nil
+	}
+
+	alias, err := db.getIndexAlias(obj)
+	if err != nil {
+		return "", err
+	}
+
+	indexName := db.indexName(obj)
+	if alias != nil && alias.Active != "" {
+		indexName = alias.Active
+	}
+	db.indexAliases.set(tableName, indexName)
+	return indexName, nil
+}
+
+//每张表的索引重建锁，与迁移锁存储在同一张表中，防止多个实例同时重建或切换同一张表的索引
+func indexLockID(tableName string) string {
+	return migrationLockID + "index/" + tableName
+}
+
+//等待获取索引重建锁，其他实例正在重建时轮询等待，超过IndexSyncTimeout返回MigrationLocked
+func (db *DB) waitIndexLock(obj interface{}) (*migrationLock, error) {
+	timeout := db.migrateOptions.IndexSyncTimeout
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		lock, err := db.acquireLock(indexLockID(db.tableName(obj)))
+		if !errors.Is(err, MigrationLocked) || time.Now().After(deadline) {
+			return lock, err
+		}
+		log.Printf("wait index lock of table %s: %s", db.tableName(obj), err)
+		time.Sleep(indexSyncPollInterval)
+	}
+}
+
+//不停机重建索引：创建新版本的索引，等待同步完成后切换别名，再删除旧索引
+//持有索引锁，多个实例同时部署时只有一个实例重建，其他实例等待后发现已切换直接返回
+func (db *DB) migrateIndex(obj interface{}, oldIndexName string) error {
+	lock, err := db.waitIndexLock(obj)
+	if err != nil {
+		return err
+	}
+	defer db.unlockMigrations(lock)
+	heartbeat := db.startMigrationHeartbeat(lock)
+	defer heartbeat.stop()
+
+	alias, err := db.getIndexAlias(obj)
+	if err != nil {
+		return err
+	}
+	if alias == nil {
+		alias = &indexAlias{ID: db.tableName(obj), Active: oldIndexName, Version: 1}
+	}
+
+	//等待锁期间其他实例已经完成了重建
+	if alias.Active != oldIndexName {
+		changed, err := db.isIndexSchemaChange(obj, alias.Active)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			log.Printf("index of table %s already migrated to %s", alias.ID, alias.Active)
+			return nil
+		}
+	}
+
+	version := alias.Version + 1
+	newIndexName := fmt.Sprintf("%s_v%d", db.indexName(obj), version)
+
+	//上次迁移中断时新索引可能已经存在，schema一致则继续等待同步，否则删除重建
+	exist, err := db.isIndexExist(obj, newIndexName)
+	if err != nil {
+		return err
+	}
+	if exist {
+		changed, err := db.isIndexSchemaChange(obj, newIndexName)
+		if err != nil {
+			return err
+		}
+		if changed {
+			log.Printf("index %s exist with different schema, recreate index", newIndexName)
+			if err := db.deleteIndex(obj, newIndexName); err != nil {
+				return err
+			}
+			exist = false
+		}
+	}
+	if !exist {
+		log.Printf("create index %s", newIndexName)
+		if err := db.createIndex(obj, newIndexName); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("wait index %s sync", newIndexName)
+	if err := db.waitIndexReady(obj, newIndexName, 0); err != nil {
+		return err
+	}
+
+	//同步期间锁被其他实例接管时不再切换，由接管的实例完成
+	if err := heartbeat.err(); err != nil {
+		return err
+	}
+
+	//回滚后再重建时，切换前的索引（回滚掉的版本）不再用于回滚，等待删除
+	//不保留旧索引时，切换下来的索引同样等待删除，删除前仍记录在Previous中可以回滚
+	retired, err := alias.retiredIndexes()
+	if err != nil {
+		return err
+	}
+	dropAfter := time.Now().Add(indexAliasCacheTTL)
+	retired = retireIndex(retired, alias.Previous, dropAfter)
+	if !db.migrateOptions.KeepPreviousIndex {
+		retired = retireIndex(retired, alias.Active, dropAfter)
+	}
+	if err := alias.setRetiredIndexes(retired); err != nil {
+		return err
+	}
+
+	alias.Previous = alias.Active
+	alias.Active = newIndexName
+	alias.Version = version
+	if err := db.saveIndexAlias(alias); err != nil {
+		return err
+	}
+	log.Printf("switch index from %s to %s", alias.Previous, alias.Active)
+
+	if !db.migrateOptions.KeepPreviousIndex {
+		log.Printf("previous index %s will be deleted after %s", alias.Previous, dropAfter.Format(time.RFC3339))
+		db.dropRetiredIndexesLater(obj)
+	}
+	return nil
+}
+
+//回滚到切换前的索引，要求旧索引还没有被删除
+//开启KeepPreviousIndex时一直可以回滚，否则只能在切换后旧索引被删除前回滚
+func (db *DB) RollbackIndex(obj interface{}) error {
+	lock, err := db.acquireLock(indexLockID(db.tableName(obj)))
+	if err != nil {
+		return err
+	}
+	defer db.unlockMigrations(lock)
+
+	alias, err := db.getIndexAlias(obj)
+	if err != nil {
+		return err
+	}
+	if alias == nil || alias.Previous == "" {
+		return fmt.Errorf("no previous index of table %s to rollback", db.tableName(obj))
+	}
+
+	exist, err := db.isIndexExist(obj, alias.Previous)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return fmt.Errorf("previous index %s has been deleted", alias.Previous)
+	}
+
+	//回滚后当前索引变为旧索引，可以再次回滚，版本号保持不变，避免新版本与已有索引重名
+	//回滚到的索引即使在等待删除的列表中也不会被删除，见dueRetiredIndexes
+	alias.Active, alias.Previous = alias.Previous, alias.Active
+	if err := db.saveIndexAlias(alias); err != nil {
+		return err
+	}
+	log.Printf("rollback index from %s to %s", alias.Previous, alias.Active)
+	return nil
+}
+
+//删除切换前的索引，之后无法回滚
+//其他实例的别名缓存过期前还可能使用旧索引，因此不会立即删除，到期后在后台删除
+func (db *DB) DropPreviousIndex(obj interface{}) error {
+	lock, err := db.acquireLock(indexLockID(db.tableName(obj)))
+	if err != nil {
+		return err
+	}
+	defer db.unlockMigrations(lock)
+
+	alias, err := db.getIndexAlias(obj)
+	if err != nil {
+		return err
+	}
+	if alias == nil {
+		return nil
+	}
+
+	if alias.Previous != "" {
+		retired, err := alias.retiredIndexes()
+		if err != nil {
+			return err
+		}
+		dropAfter := time.Now().Add(indexAliasCacheTTL)
+		if err := alias.setRetiredIndexes(retireIndex(retired, alias.Previous, dropAfter)); err != nil {
+			return err
+		}
+		log.Printf("previous index %s will be deleted after %s", alias.Previous, dropAfter.Format(time.RFC3339))
+
+		alias.Previous = ""
+		if err := db.saveIndexAlias(alias); err != nil {
+			return err
+		}
+		db.dropRetiredIndexesLater(obj)
+	}
+	return db.dropRetiredIndexes(obj, alias)
+}
+
+//等其他实例的别名缓存过期后在后台删除旧索引，进程提前退出时由之后的AutoMigrate或DropPreviousIndex删除
+func (db *DB) dropRetiredIndexesLater(obj interface{}) {
+	time.AfterFunc(indexAliasCacheTTL+time.Second, func() {
+		if err := db.dropRetiredIndexesLocked(obj); err != nil {
+			log.Printf("drop retired indexes of table %s error %s", db.tableName(obj), err)
+		}
+	})
+}
+
+//持有索引锁时删除到期的旧索引，其他实例正在重建时跳过，留给之后的AutoMigrate删除
+func (db *DB) dropRetiredIndexesLocked(obj interface{}) error {
+	lock, err := db.acquireLock(indexLockID(db.tableName(obj)))
+	if errors.Is(err, MigrationLocked) {
+		log.Printf("skip drop retired indexes of table %s: %s", db.tableName(obj), err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer db.unlockMigrations(lock)
+
+	alias, err := db.getIndexAlias(obj)
+	if err != nil || alias == nil {
+		return err
+	}
+	return db.dropRetiredIndexes(obj, alias)
+}
+
+//删除已经到期的旧索引，索引已经不存在时忽略，删除的是Previous时之后无法回滚
+func (db *DB) dropRetiredIndexes(obj interface{}, alias *indexAlias) error {
+	retired, err := alias.retiredIndexes()
+	if err != nil {
+		return err
+	}
+	due, remaining := dueRetiredIndexes(retired, time.Now(), alias.Active)
+	if len(due) == 0 {
+		return nil
+	}
+
+	for _, indexName := range due {
+		log.Printf("delete retired index %s", indexName)
+		if err := db.deleteIndex(obj, indexName); err != nil && !isObjectNotExist(err) {
+			return err
+		}
+		if indexName == alias.Previous {
+			alias.Previous = ""
+		}
+	}
+	if err := alias.setRetiredIndexes(remaining); err != nil {
+		return err
+	}
+	return db.saveIndexAlias(alias)
+}
+
+//表或索引不存在时TableStore返回的错误码
+const objectNotExistCode = "OTSObjectNotExist"
+
+func isObjectNotExist(err error) bool {
+	var otsErr *tablestore.OtsError
+	return errors.As(err, &otsErr) && otsErr.Code == objectNotExistCode
+}
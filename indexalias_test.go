@@ -0,0 +1,136 @@
+package tableorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type aliasUser struct {
+	ID string `json:"_id"`
+}
+
+func TestIndexAliasCache(t *testing.T) {
+	cache := newIndexAliasCache()
+	if _, ok := cache.get("user"); ok {
+		t.Fatal("empty cache should miss")
+	}
+
+	cache.set("user", "user_index_v2")
+	if got, ok := cache.get("user"); !ok || got != "user_index_v2" {
+		t.Errorf("get() = %q, %v, want user_index_v2", got, ok)
+	}
+
+	cache.delete("user")
+	if _, ok := cache.get("user"); ok {
+		t.Error("deleted entry should miss")
+	}
+
+	cache.entries["user"] = indexAliasCacheEntry{indexName: "user_index", expireAt: time.Now().Add(-time.Second)}
+	if _, ok := cache.get("user"); ok {
+		t.Error("expired entry should miss")
+	}
+}
+
+func TestActiveIndexNameCached(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	db.indexAliases.set("aliasuser", "aliasuser_index_v3")
+
+	indexName, err := db.activeIndexName(&aliasUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexName != "aliasuser_index_v3" {
+		t.Errorf("activeIndexName() = %q, want aliasuser_index_v3", indexName)
+	}
+}
+
+func TestIndexAliasTableName(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk").SetNamingStrategy(NamingStrategy{TablePrefix: "app_"})
+	if got := db.tableName(&indexAlias{}); got != "tableorm_index_alias" {
+		t.Errorf("table name = %q, want tableorm_index_alias", got)
+	}
+}
+
+func TestRetireIndex(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	later := now.Add(time.Minute)
+	tests := []struct {
+		name  string
+		list  []retiredIndex
+		index string
+		at    time.Time
+		want  []retiredIndex
+	}{
+		{"empty name", []retiredIndex{}, "", now, []retiredIndex{}},
+		{"append", []retiredIndex{{"user_index", now.Unix()}}, "user_index_v2", later, []retiredIndex{{"user_index", now.Unix()}, {"user_index_v2", later.Unix()}}},
+		{"keep later drop time", []retiredIndex{{"user_index", later.Unix()}}, "user_index", now, []retiredIndex{{"user_index", later.Unix()}}},
+		{"extend drop time", []retiredIndex{{"user_index", now.Unix()}}, "user_index", later, []retiredIndex{{"user_index", later.Unix()}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retireIndex(tt.list, tt.index, tt.at); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retireIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDueRetiredIndexes(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	list := []retiredIndex{
+		{"user_index", now.Unix() - 1},
+		{"user_index_v2", now.Unix()},
+		{"user_index_v3", now.Unix() + 1},
+		{"user_index_v4", now.Unix() - 1},
+	}
+	due, remaining := dueRetiredIndexes(list, now, "user_index_v4")
+
+	if want := []string{"user_index", "user_index_v2"}; !reflect.DeepEqual(due, want) {
+		t.Errorf("due = %v, want %v", due, want)
+	}
+	if want := []retiredIndex{{"user_index_v3", now.Unix() + 1}}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("remaining = %v, want %v", remaining, want)
+	}
+}
+
+func TestIndexAliasRetiredRoundTrip(t *testing.T) {
+	alias := &indexAlias{ID: "user"}
+	list, err := alias.retiredIndexes()
+	if err != nil || len(list) != 0 {
+		t.Fatalf("retiredIndexes() = %v, %v, want empty", list, err)
+	}
+
+	//回滚后再重建：v2被回滚掉，重建v3时v2进入等待删除的列表
+	want := []retiredIndex{{"user_index_v2", 1600000060}}
+	if err := alias.setRetiredIndexes(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := alias.retiredIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("retiredIndexes() = %v, want %v", got, want)
+	}
+
+	if err := alias.setRetiredIndexes(nil); err != nil || alias.Retired != "" {
+		t.Errorf("setRetiredIndexes(nil) Retired = %q, %v", alias.Retired, err)
+	}
+	alias.Retired = "not json"
+	if _, err := alias.retiredIndexes(); err == nil {
+		t.Error("retiredIndexes() expected error for invalid data")
+	}
+}
+
+func TestIndexLockID(t *testing.T) {
+	user, book := indexLockID("user"), indexLockID("book")
+	if user == book || user == migrationLockID {
+		t.Errorf("indexLockID() = %q, %q, want distinct from each other and %q", user, book, migrationLockID)
+	}
+	//appliedMigrations按前缀跳过锁，索引锁不能被当作已执行的迁移
+	if !strings.HasPrefix(user, migrationLockID) {
+		t.Errorf("indexLockID() = %q, want prefix %q", user, migrationLockID)
+	}
+}
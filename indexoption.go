@@ -0,0 +1,217 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/oleiade/reflections"
+	"reflect"
+)
+
+//索引级配置
+type IndexOptions struct {
+	//路由字段，必须是主键列，填写列名，查询条件固定了路由字段时只查询对应的分区
+	RoutingFields []string
+	//预排序，为空时按主键排序，查询时使用相同的排序可以提前结束
+	IndexSort []search.Sorter
+}
+
+//模型可以实现该接口来指定索引级配置，优先级高于tag
+type IndexOptionsProvider interface {
+	IndexOptions() IndexOptions
+}
+
+//获取模型的索引级配置，优先级为 模型方法 > tag
+//通过字段上的 tableorm:"routing" 指定路由字段，tableorm:"indexSort" 或 tableorm:"indexSort:desc" 指定预排序，按字段定义顺序排列
+func GetIndexOptions(obj interface{}) (*IndexOptions, error) {
+	if provider, ok := obj.(IndexOptionsProvider); ok {
+		options := provider.IndexOptions()
+		return &options, nil
+	}
+
+	fieldToJSONMap, _, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := getModelFieldNames(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &IndexOptions{}
+	for _, field := range fields {
+		tag, _ := reflections.GetFieldTag(obj, field, "tableorm")
+		settings := parseTableormTag(tag)
+		column := fieldToJSONMap[field]
+
+		if _, ok := settings["routing"]; ok {
+			options.RoutingFields = append(options.RoutingFields, column)
+		}
+
+		order, ok := settings["indexSort"]
+		if !ok {
+			continue
+		}
+		switch order {
+		case "", "asc":
+			options.IndexSort = append(options.IndexSort, search.NewFieldSort(column, search.SortOrder_ASC))
+		case "desc":
+			options.IndexSort = append(options.IndexSort, search.NewFieldSort(column, search.SortOrder_DESC))
+		default:
+			return nil, fmt.Errorf("unexpected index sort order %s %s", field, order)
+		}
+	}
+	return options, nil
+}
+
+//根据模型生成完整的索引schema，包括字段、路由字段和预排序
+func CreateIndexSchemaWithOptions(obj interface{}) (*tablestore.IndexSchema, error) {
+	schemas, err := CreateIndexSchema(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := GetIndexOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	//路由字段只能是主键列
+	for _, routingField := range options.RoutingFields {
+		found := false
+		for _, pkField := range pkFields {
+			if pkField.Column == routingField {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("routing field %s must be primary key", routingField)
+		}
+	}
+
+	//预排序字段需要开启排序，且不能是数组
+	for _, sorter := range options.IndexSort {
+		fieldSort, ok := sorter.(*search.FieldSort)
+		if !ok {
+			continue
+		}
+		var fieldSchema *tablestore.FieldSchema
+		for _, schema := range schemas {
+			if *schema.FieldName == fieldSort.FieldName {
+				fieldSchema = schema
+				break
+			}
+		}
+		if fieldSchema == nil {
+			return nil, fmt.Errorf("index sort field %s is not indexed", fieldSort.FieldName)
+		}
+		if !*fieldSchema.EnableSortAndAgg || (fieldSchema.IsArray != nil && *fieldSchema.IsArray) {
+			return nil, fmt.Errorf("index sort field %s must enable sort and can not be array", fieldSort.FieldName)
+		}
+	}
+
+	indexSchema := &tablestore.IndexSchema{
+		FieldSchemas: schemas,
+	}
+	if len(options.RoutingFields) > 0 {
+		indexSchema.IndexSetting = &tablestore.IndexSetting{RoutingFields: options.RoutingFields}
+	}
+	if len(options.IndexSort) > 0 {
+		indexSchema.IndexSort = &search.Sort{Sorters: options.IndexSort}
+	}
+	return indexSchema, nil
+}
+
+//查询条件中通过TermQuery、TermsQuery固定了所有路由字段时，返回对应的路由值，否则返回空查询所有分区
+//只识别顶层以及must、filter中的条件，should、must_not无法确定路由字段的值
+func getRoutingValues(obj interface{}, query search.Query) ([]*tablestore.PrimaryKey, error) {
+	options, err := GetIndexOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(options.RoutingFields) == 0 {
+		return nil, nil
+	}
+
+	terms := map[string][]interface{}{}
+	collectTerms(query, terms)
+
+	//多个路由字段时取各字段值的笛卡尔积
+	combinations := [][]interface{}{{}}
+	for _, routingField := range options.RoutingFields {
+		values, ok := terms[routingField]
+		if !ok {
+			return nil, nil
+		}
+		next := [][]interface{}{}
+		for _, combination := range combinations {
+			for _, value := range values {
+				row := append(append([]interface{}{}, combination...), value)
+				next = append(next, row)
+			}
+		}
+		combinations = next
+	}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	routingValues := []*tablestore.PrimaryKey{}
+	for _, combination := range combinations {
+		pk := new(tablestore.PrimaryKey)
+		for i, routingField := range options.RoutingFields {
+			value := toPrimaryKeyValue(combination[i])
+			if routingField == pkFields[0].Column {
+				value, err = encodeID(obj, value)
+				if err != nil {
+					return nil, err
+				}
+			}
+			pk.AddPrimaryKeyColumn(routingField, value)
+		}
+		routingValues = append(routingValues, pk)
+	}
+	return routingValues, nil
+}
+
+//收集查询条件中固定取值的字段，同一字段出现多次时只保留第一次
+func collectTerms(query search.Query, terms map[string][]interface{}) {
+	switch q := query.(type) {
+	case *search.TermQuery:
+		if _, ok := terms[q.FieldName]; !ok {
+			terms[q.FieldName] = []interface{}{q.Term}
+		}
+	case *search.TermsQuery:
+		if _, ok := terms[q.FieldName]; !ok && len(q.Terms) > 0 {
+			terms[q.FieldName] = q.Terms
+		}
+	case *search.BoolQuery:
+		for _, sub := range q.MustQueries {
+			collectTerms(sub, terms)
+		}
+		for _, sub := range q.FilterQueries {
+			collectTerms(sub, terms)
+		}
+	}
+}
+
+//查询条件中的整数可能是int等类型，主键只支持int64
+func toPrimaryKeyValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(v.Uint())
+	}
+	return value
+}
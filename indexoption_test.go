@@ -0,0 +1,125 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"reflect"
+	"testing"
+)
+
+type routingMetric struct {
+	Tenant string  `json:"tenant" pk:"1" tableorm:"routing;hashPrefix"`
+	Device int64   `json:"device" pk:"2" tableorm:"routing"`
+	Ts     int64   `json:"ts" pk:"3"`
+	Value  float64 `json:"value" tableorm:"indexSort:desc"`
+}
+
+type routingOrder struct {
+	ID     string `json:"_id"`
+	UserID string `json:"user_id" tableorm:"routing"`
+}
+
+type indexSortNoSort struct {
+	ID    string `json:"_id"`
+	Score int64  `json:"score" index:",nosort" tableorm:"indexSort"`
+}
+
+func TestGetIndexOptions(t *testing.T) {
+	options, err := GetIndexOptions(&routingMetric{})
+	if err != nil {
+		t.Fatalf("GetIndexOptions() error = %v", err)
+	}
+	if want := []string{"tenant", "device"}; !reflect.DeepEqual(options.RoutingFields, want) {
+		t.Errorf("RoutingFields = %v, want %v", options.RoutingFields, want)
+	}
+	want := []search.Sorter{search.NewFieldSort("value", search.SortOrder_DESC)}
+	if !reflect.DeepEqual(options.IndexSort, want) {
+		t.Errorf("IndexSort = %v, want %v", options.IndexSort, want)
+	}
+
+	bad := &struct {
+		ID string `json:"_id" tableorm:"indexSort:up"`
+	}{}
+	if _, err := GetIndexOptions(bad); err == nil {
+		t.Error("GetIndexOptions() expected error for unknown sort order")
+	}
+}
+
+func TestCreateIndexSchemaWithOptions(t *testing.T) {
+	indexSchema, err := CreateIndexSchemaWithOptions(&routingMetric{})
+	if err != nil {
+		t.Fatalf("CreateIndexSchemaWithOptions() error = %v", err)
+	}
+	if indexSchema.IndexSetting == nil || !reflect.DeepEqual(indexSchema.IndexSetting.RoutingFields, []string{"tenant", "device"}) {
+		t.Errorf("IndexSetting = %+v, want routing tenant, device", indexSchema.IndexSetting)
+	}
+	if indexSchema.IndexSort == nil || len(indexSchema.IndexSort.Sorters) != 1 {
+		t.Errorf("IndexSort = %+v, want one sorter", indexSchema.IndexSort)
+	}
+
+	if _, err := CreateIndexSchemaWithOptions(&routingOrder{}); err == nil {
+		t.Error("CreateIndexSchemaWithOptions() expected error for routing field not in primary key")
+	}
+	if _, err := CreateIndexSchemaWithOptions(&indexSortNoSort{}); err == nil {
+		t.Error("CreateIndexSchemaWithOptions() expected error for index sort without sort enabled")
+	}
+}
+
+
+func TestCollectTerms(t *testing.T) {
+	query := &search.BoolQuery{
+		MustQueries: []search.Query{
+			&search.TermQuery{FieldName: "tenant", Term: "a"},
+			&search.BoolQuery{FilterQueries: []search.Query{
+				&search.TermsQuery{FieldName: "device", Terms: []interface{}{1, 2}},
+			}},
+			&search.TermQuery{FieldName: "tenant", Term: "b"},
+		},
+		ShouldQueries:  []search.Query{&search.TermQuery{FieldName: "user", Term: "u1"}},
+		MustNotQueries: []search.Query{&search.TermQuery{FieldName: "status", Term: "deleted"}},
+	}
+
+	terms := map[string][]interface{}{}
+	collectTerms(query, terms)
+	want := map[string][]interface{}{
+		"tenant": {"a"},
+		"device": {1, 2},
+	}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("collectTerms() = %v, want %v", terms, want)
+	}
+}
+
+func TestGetRoutingValues(t *testing.T) {
+	query := &search.BoolQuery{
+		MustQueries: []search.Query{
+			&search.TermQuery{FieldName: "tenant", Term: "a"},
+			&search.TermsQuery{FieldName: "device", Terms: []interface{}{1, int64(2)}},
+		},
+	}
+	routingValues, err := getRoutingValues(&routingMetric{}, query)
+	if err != nil {
+		t.Fatalf("getRoutingValues() error = %v", err)
+	}
+	if len(routingValues) != 2 {
+		t.Fatalf("getRoutingValues() returned %d values, want 2", len(routingValues))
+	}
+	for i, device := range []int64{1, 2} {
+		pk := routingValues[i].PrimaryKeys
+		if len(pk) != 2 || pk[0].ColumnName != "tenant" || pk[0].Value != AddHashPrefix("a") || pk[1].ColumnName != "device" || pk[1].Value != device {
+			t.Errorf("routingValues[%d] = %s=%v,%s=%v, want tenant=%s,device=%d", i, pk[0].ColumnName, pk[0].Value, pk[1].ColumnName, pk[1].Value, AddHashPrefix("a"), device)
+		}
+	}
+
+	//没有固定所有路由字段时查询所有分区
+	partial := &search.TermQuery{FieldName: "tenant", Term: "a"}
+	if routingValues, err := getRoutingValues(&routingMetric{}, partial); err != nil || routingValues != nil {
+		t.Errorf("getRoutingValues() = %v, %v, want nil", routingValues, err)
+	}
+	should := &search.BoolQuery{ShouldQueries: []search.Query{query}}
+	if routingValues, err := getRoutingValues(&routingMetric{}, should); err != nil || routingValues != nil {
+		t.Errorf("getRoutingValues() with should = %v, %v, want nil", routingValues, err)
+	}
+	if routingValues, err := getRoutingValues(&plainUser{}, query); err != nil || routingValues != nil {
+		t.Errorf("getRoutingValues() without routing fields = %v, %v, want nil", routingValues, err)
+	}
+}
@@ -0,0 +1,124 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"log"
+	"time"
+)
+
+//索引同步状态的轮询间隔
+const indexSyncPollInterval = 10 * time.Second
+
+//增量同步的延迟小于该值时认为索引已就绪
+const indexReadyMaxLag = 10 * time.Second
+
+//索引同步进度，每次轮询时回调一次
+type IndexSyncProgress struct {
+	Table string
+	Index string
+	//全量同步或增量同步
+	SyncPhase tablestore.SyncPhase
+	//已同步到的时间点，全量同步阶段为空
+	SyncedAt time.Time
+	//增量同步的延迟，全量同步阶段为0
+	Lag time.Duration
+	//已等待的时间
+	Elapsed time.Duration
+	Ready   bool
+}
+
+func (p *IndexSyncProgress) String() string {
+	if p.SyncPhase == tablestore.SyncPhase_FULL {
+		return fmt.Sprintf("index %s full sync, waited %s", p.Index, p.Elapsed.Round(time.Second))
+	}
+	return fmt.Sprintf("index %s incremental sync, lag %s, waited %s", p.Index, p.Lag.Round(time.Millisecond), p.Elapsed.Round(time.Second))
+}
+
+//等待当前使用的索引同步完成，即进入增量同步且同步进度接近当前时间
+//CreateIndex只是提交请求，之后立即查询会得到不完整的结果
+//timeout为0时使用MigrateOptions中的IndexSyncTimeout，默认1小时
+func (db *DB) WaitIndexReady(obj interface{}, timeout time.Duration) error {
+	indexName, err := db.activeIndexName(obj)
+	if err != nil {
+		return err
+	}
+	return db.waitIndexReady(obj, indexName, timeout)
+}
+
+func (db *DB) waitIndexReady(obj interface{}, indexName string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = db.migrateOptions.IndexSyncTimeout
+	}
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+	start := time.Now()
+
+	for {
+		progress, err := db.indexSyncProgress(obj, indexName)
+		if err != nil {
+			return err
+		}
+		progress.Elapsed = time.Since(start)
+		db.reportIndexProgress(progress)
+		if progress.Ready {
+			return nil
+		}
+
+		if progress.Elapsed > timeout {
+			return fmt.Errorf("%w: %s after %s", IndexNotReady, indexName, timeout)
+		}
+		time.Sleep(indexSyncPollInterval)
+	}
+}
+
+func (db *DB) indexSyncProgress(obj interface{}, indexName string) (*IndexSyncProgress, error) {
+	resp, err := db.client.DescribeSearchIndex(&tablestore.DescribeSearchIndexRequest{
+		TableName: db.tableName(obj),
+		IndexName: indexName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newIndexSyncProgress(db.tableName(obj), indexName, resp.SyncStat, time.Now()), nil
+}
+
+//根据同步状态判断索引是否就绪，没有返回同步状态时视为全量同步
+func newIndexSyncProgress(table, index string, syncStat *tablestore.SyncStat, now time.Time) *IndexSyncProgress {
+	progress := &IndexSyncProgress{
+		Table:     table,
+		Index:     index,
+		SyncPhase: tablestore.SyncPhase_FULL,
+	}
+	if syncStat == nil {
+		return progress
+	}
+	progress.SyncPhase = syncStat.SyncPhase
+	if progress.SyncPhase != tablestore.SyncPhase_INCR {
+		return progress
+	}
+
+	//同步时间点的单位为纳秒，没有返回时只能以进入增量同步为准
+	if syncStat.CurrentSyncTimestamp == nil {
+		progress.Ready = true
+		return progress
+	}
+	progress.SyncedAt = time.Unix(0, *syncStat.CurrentSyncTimestamp)
+	progress.Lag = now.Sub(progress.SyncedAt)
+	if progress.Lag < 0 {
+		progress.Lag = 0
+	}
+	progress.Ready = progress.Lag <= indexReadyMaxLag
+	return progress
+}
+
+//没有设置OnIndexProgress时记录日志
+func (db *DB) reportIndexProgress(progress *IndexSyncProgress) {
+	if db.migrateOptions.OnIndexProgress != nil {
+		db.migrateOptions.OnIndexProgress(progress)
+		return
+	}
+	log.Printf("wait %s", progress)
+}
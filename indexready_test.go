@@ -0,0 +1,54 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"testing"
+	"time"
+)
+
+func TestNewIndexSyncProgress(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timestamp := func(d time.Duration) *int64 {
+		ts := now.Add(-d).UnixNano()
+		return &ts
+	}
+
+	tests := []struct {
+		name     string
+		syncStat *tablestore.SyncStat
+		phase    tablestore.SyncPhase
+		lag      time.Duration
+		ready    bool
+	}{
+		{"no sync stat", nil, tablestore.SyncPhase_FULL, 0, false},
+		{"full sync", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_FULL, CurrentSyncTimestamp: timestamp(0)}, tablestore.SyncPhase_FULL, 0, false},
+		{"incremental without timestamp", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_INCR}, tablestore.SyncPhase_INCR, 0, true},
+		{"incremental caught up", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_INCR, CurrentSyncTimestamp: timestamp(3 * time.Second)}, tablestore.SyncPhase_INCR, 3 * time.Second, true},
+		{"incremental at max lag", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_INCR, CurrentSyncTimestamp: timestamp(indexReadyMaxLag)}, tablestore.SyncPhase_INCR, indexReadyMaxLag, true},
+		{"incremental lagging", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_INCR, CurrentSyncTimestamp: timestamp(time.Minute)}, tablestore.SyncPhase_INCR, time.Minute, false},
+		//服务端时间比本地快时延迟按0处理
+		{"clock skew", &tablestore.SyncStat{SyncPhase: tablestore.SyncPhase_INCR, CurrentSyncTimestamp: timestamp(-time.Second)}, tablestore.SyncPhase_INCR, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := newIndexSyncProgress("user", "user_index", tt.syncStat, now)
+			if progress.Table != "user" || progress.Index != "user_index" {
+				t.Errorf("progress = %s/%s, want user/user_index", progress.Table, progress.Index)
+			}
+			if progress.SyncPhase != tt.phase || progress.Lag != tt.lag || progress.Ready != tt.ready {
+				t.Errorf("progress = %v %s ready %v, want %v %s ready %v", progress.SyncPhase, progress.Lag, progress.Ready, tt.phase, tt.lag, tt.ready)
+			}
+		})
+	}
+}
+
+func TestIndexSyncProgressString(t *testing.T) {
+	full := &IndexSyncProgress{Index: "user_index", SyncPhase: tablestore.SyncPhase_FULL, Elapsed: 90 * time.Second}
+	if want := "index user_index full sync, waited 1m30s"; full.String() != want {
+		t.Errorf("String() = %q, want %q", full.String(), want)
+	}
+	incr := &IndexSyncProgress{Index: "user_index", SyncPhase: tablestore.SyncPhase_INCR, Lag: 1500 * time.Millisecond, Elapsed: 2 * time.Minute}
+	if want := "index user_index incremental sync, lag 1.5s, waited 2m0s"; incr.String() != want {
+		t.Errorf("String() = %q, want %q", incr.String(), want)
+	}
+}
@@ -0,0 +1,237 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/golang/protobuf/proto"
+	"strconv"
+	"strings"
+)
+
+var tagToAnalyzerMap = map[string]tablestore.Analyzer{
+	"single_word": tablestore.Analyzer_SingleWord,
+	"max_word":    tablestore.Analyzer_MaxWord,
+	"min_word":    tablestore.Analyzer_MinWord,
+	"split":       tablestore.Analyzer_Split,
+	"fuzzy":       tablestore.Analyzer_Fuzzy,
+}
+
+//fuzzy分词的默认n-gram长度，与服务端默认值一致
+const (
+	defaultFuzzyMinChars = 1
+	defaultFuzzyMaxChars = 7
+)
+
+//index tag，第一项为索引类型，为空时根据字段类型推断，其余为选项
+//例如 index:"text,analyzer=split,delimiter=\,"，选项值中的逗号用 \, 转义
+type indexTag struct {
+	Type    string
+	Options map[string]string
+}
+
+func parseIndexTag(tag string) *indexTag {
+	parts := []string{}
+	var b strings.Builder
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',' {
+			b.WriteByte(',')
+			i++
+			continue
+		}
+		if tag[i] == ',' {
+			parts = append(parts, b.String())
+			b.Reset()
+			continue
+		}
+		b.WriteByte(tag[i])
+	}
+	parts = append(parts, b.String())
+
+	result := &indexTag{Type: strings.TrimSpace(parts[0]), Options: map[string]string{}}
+	for _, part := range parts[1:] {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) == 2 {
+			//分隔符可能是空格，值不做trim
+			result.Options[key] = kv[1]
+		} else {
+			result.Options[key] = ""
+		}
+	}
+	return result
+}
+
+//index tag中支持的选项，其他选项视为拼写错误
+var indexTagOptions = map[string]bool{
+	"nosort":        true,
+	"nostore":       true,
+	"array":         true,
+	"analyzer":      true,
+	"caseSensitive": true,
+	"delimitWord":   true,
+	"delimiter":     true,
+	"minChars":      true,
+	"maxChars":      true,
+}
+
+//排序和统计聚合的默认值，TEXT和NESTED不支持，其余类型默认开启
+func defaultSortAndAgg(fieldType tablestore.FieldType) *bool {
+	switch fieldType {
+	case tablestore.FieldType_TEXT, tablestore.FieldType_NESTED:
+		return proto.Bool(false)
+	}
+	return proto.Bool(true)
+}
+
+//根据tag设置字段的索引选项，默认开启存储，排序聚合的默认值见defaultSortAndAgg
+//nosort关闭排序和统计聚合，nostore不在索引中存储原始值，查询时需要反查表
+//array表示字段为数组，字段类型为string，值为json数组，例如 ["a","b"]，索引类型为数组元素的类型
+func setIndexOptions(field string, schema *tablestore.FieldSchema, options map[string]string) error {
+	for key := range options {
+		if !indexTagOptions[key] {
+			return fmt.Errorf("unexpected field %s index option %s", field, key)
+		}
+	}
+
+	if _, ok := options["nosort"]; ok {
+		schema.EnableSortAndAgg = proto.Bool(false)
+	}
+	if _, ok := options["nostore"]; ok {
+		schema.Store = proto.Bool(false)
+	}
+	if _, ok := options["array"]; ok {
+		schema.IsArray = proto.Bool(true)
+	}
+
+	return setAnalyzer(field, schema, options)
+}
+
+//根据tag设置TEXT字段的分词器及参数
+//single_word支持caseSensitive、delimitWord，split支持delimiter，fuzzy支持minChars、maxChars
+func setAnalyzer(field string, schema *tablestore.FieldSchema, options map[string]string) error {
+	name, ok := options["analyzer"]
+	if !ok {
+		for _, key := range []string{"caseSensitive", "delimitWord", "delimiter", "minChars", "maxChars"} {
+			if _, ok := options[key]; ok {
+				return fmt.Errorf("field %s option %s requires analyzer", field, key)
+			}
+		}
+		return nil
+	}
+
+	if schema.FieldType != tablestore.FieldType_TEXT {
+		return fmt.Errorf("field %s analyzer only support text index", field)
+	}
+	analyzer, ok := tagToAnalyzerMap[name]
+	if !ok {
+		return fmt.Errorf("unexpected field %s analyzer %s", field, name)
+	}
+	schema.Analyzer = &analyzer
+
+	boolOption := func(key string) (*bool, error) {
+		value, ok := options[key]
+		if !ok {
+			return nil, nil
+		}
+		//只写key时表示true
+		if value == "" {
+			return proto.Bool(true), nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected field %s option %s=%s", field, key, value)
+		}
+		return proto.Bool(b), nil
+	}
+	intOption := func(key string, defaultValue int32) (int32, error) {
+		value, ok := options[key]
+		if !ok {
+			return defaultValue, nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("unexpected field %s option %s=%s", field, key, value)
+		}
+		return int32(n), nil
+	}
+
+	switch analyzer {
+	case tablestore.Analyzer_SingleWord:
+		caseSensitive, err := boolOption("caseSensitive")
+		if err != nil {
+			return err
+		}
+		delimitWord, err := boolOption("delimitWord")
+		if err != nil {
+			return err
+		}
+		if caseSensitive != nil || delimitWord != nil {
+			schema.AnalyzerParameter = tablestore.SingleWordAnalyzerParameter{
+				CaseSensitive: caseSensitive,
+				DelimitWord:   delimitWord,
+			}
+		}
+	case tablestore.Analyzer_Split:
+		if delimiter, ok := options["delimiter"]; ok {
+			if delimiter == "" {
+				return fmt.Errorf("field %s delimiter can not be empty", field)
+			}
+			schema.AnalyzerParameter = tablestore.SplitAnalyzerParameter{Delimiter: proto.String(delimiter)}
+		}
+	case tablestore.Analyzer_Fuzzy:
+		minChars, err := intOption("minChars", defaultFuzzyMinChars)
+		if err != nil {
+			return err
+		}
+		maxChars, err := intOption("maxChars", defaultFuzzyMaxChars)
+		if err != nil {
+			return err
+		}
+		if minChars > maxChars {
+			return fmt.Errorf("field %s minChars %d greater than maxChars %d", field, minChars, maxChars)
+		}
+		schema.AnalyzerParameter = tablestore.FuzzyAnalyzerParameter{MinChars: minChars, MaxChars: maxChars}
+	}
+	return nil
+}
+
+//虚拟列，同一列以不同的名称和类型建立索引，例如同时支持分词查询和精确查询
+//例如 virtual:"title_fuzzy:text,analyzer=fuzzy;title_kw:keyword"，名称后为index tag，必须指定索引类型
+//虚拟列只用于查询，不能在结果中返回，因此默认不存储
+func virtualFieldSchemas(field, column, tag string) ([]*tablestore.FieldSchema, error) {
+	schemas := []*tablestore.FieldSchema{}
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || name == "" {
+			return nil, fmt.Errorf("unexpected field %s virtual field %s, use name:type", field, item)
+		}
+
+		indexTag := parseIndexTag(kv[1])
+		fieldType, ok := tagToIndexTypeMap[indexTag.Type]
+		if !ok {
+			return nil, fmt.Errorf("unexpected field %s virtual field %s type %s", field, name, indexTag.Type)
+		}
+		schema := &tablestore.FieldSchema{
+			FieldName:        proto.String(name),
+			FieldType:        fieldType,
+			Index:            proto.Bool(true),
+			EnableSortAndAgg: defaultSortAndAgg(fieldType),
+			Store:            proto.Bool(false),
+			IsVirtualField:   proto.Bool(true),
+			SourceFieldNames: []string{column},
+		}
+		if err := setIndexOptions(field, schema, indexTag.Options); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
@@ -0,0 +1,286 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIndexTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want *indexTag
+	}{
+		{"", &indexTag{Type: "", Options: map[string]string{}}},
+		{"text", &indexTag{Type: "text", Options: map[string]string{}}},
+		{",analyzer=max_word", &indexTag{Type: "", Options: map[string]string{"analyzer": "max_word"}}},
+		{"text,analyzer=single_word,caseSensitive", &indexTag{Type: "text", Options: map[string]string{"analyzer": "single_word", "caseSensitive": ""}}},
+		{`text,analyzer=split,delimiter=\,`, &indexTag{Type: "text", Options: map[string]string{"analyzer": "split", "delimiter": ","}}},
+		{"text,analyzer=split,delimiter= ", &indexTag{Type: "text", Options: map[string]string{"analyzer": "split", "delimiter": " "}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := parseIndexTag(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIndexTag(%q) = %+v, want %+v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func textSchema(options map[string]string) (*tablestore.FieldSchema, error) {
+	schema := fieldSchema("content", tablestore.FieldType_TEXT)
+	return schema, setAnalyzer("Content", schema, options)
+}
+
+func TestSetAnalyzer(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]string
+		analyzer  tablestore.Analyzer
+		parameter interface{}
+	}{
+		{"max_word", map[string]string{"analyzer": "max_word"}, tablestore.Analyzer_MaxWord, nil},
+		{"single_word", map[string]string{"analyzer": "single_word", "caseSensitive": "", "delimitWord": "false"}, tablestore.Analyzer_SingleWord,
+			tablestore.SingleWordAnalyzerParameter{CaseSensitive: proto.Bool(true), DelimitWord: proto.Bool(false)}},
+		{"split", map[string]string{"analyzer": "split", "delimiter": ","}, tablestore.Analyzer_Split,
+			tablestore.SplitAnalyzerParameter{Delimiter: proto.String(",")}},
+		{"fuzzy default", map[string]string{"analyzer": "fuzzy"}, tablestore.Analyzer_Fuzzy,
+			tablestore.FuzzyAnalyzerParameter{MinChars: defaultFuzzyMinChars, MaxChars: defaultFuzzyMaxChars}},
+		{"fuzzy", map[string]string{"analyzer": "fuzzy", "minChars": "2", "maxChars": "5"}, tablestore.Analyzer_Fuzzy,
+			tablestore.FuzzyAnalyzerParameter{MinChars: 2, MaxChars: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := textSchema(tt.options)
+			if err != nil {
+				t.Fatalf("setAnalyzer() error = %v", err)
+			}
+			if schema.Analyzer == nil || *schema.Analyzer != tt.analyzer {
+				t.Errorf("Analyzer = %v, want %v", schema.Analyzer, tt.analyzer)
+			}
+			if !reflect.DeepEqual(schema.AnalyzerParameter, tt.parameter) {
+				t.Errorf("AnalyzerParameter = %+v, want %+v", schema.AnalyzerParameter, tt.parameter)
+			}
+		})
+	}
+}
+
+func TestSetAnalyzerError(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+	}{
+		{"unknown analyzer", map[string]string{"analyzer": "ik"}},
+		{"parameter without analyzer", map[string]string{"delimiter": ","}},
+		{"bad bool", map[string]string{"analyzer": "single_word", "caseSensitive": "yes"}},
+		{"empty delimiter", map[string]string{"analyzer": "split", "delimiter": ""}},
+		{"bad chars", map[string]string{"analyzer": "fuzzy", "minChars": "0"}},
+		{"min greater than max", map[string]string{"analyzer": "fuzzy", "minChars": "5", "maxChars": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := textSchema(tt.options); err == nil {
+				t.Error("setAnalyzer() expected error")
+			}
+		})
+	}
+
+	schema := fieldSchema("name", tablestore.FieldType_KEYWORD)
+	if err := setAnalyzer("Name", schema, map[string]string{"analyzer": "max_word"}); err == nil {
+		t.Error("setAnalyzer() expected error for keyword field")
+	}
+}
+
+func TestCreateIndexSchemaAnalyzer(t *testing.T) {
+	obj := &struct {
+		ID    string `json:"_id"`
+		Title string `json:"title" index:"text,analyzer=split,delimiter=\\,"`
+	}{}
+
+	schemas, err := CreateIndexSchema(obj)
+	if err != nil {
+		t.Fatalf("CreateIndexSchema() error = %v", err)
+	}
+	for _, schema := range schemas {
+		if *schema.FieldName != "title" {
+			continue
+		}
+		if *schema.Analyzer != tablestore.Analyzer_Split {
+			t.Errorf("title Analyzer = %v, want split", *schema.Analyzer)
+		}
+		if param := schema.AnalyzerParameter.(tablestore.SplitAnalyzerParameter); *param.Delimiter != "," {
+			t.Errorf("title delimiter = %q, want ,", *param.Delimiter)
+		}
+		return
+	}
+	t.Error("CreateIndexSchema() has no title field")
+}
+
+
+func TestCreateIndexSchemaOptions(t *testing.T) {
+	obj := &struct {
+		ID    string `json:"_id"`
+		Tags  string `json:"tags" index:"keyword,array"`
+		Score int64  `json:"score" index:",nosort,nostore"`
+	}{}
+
+	schemas, err := CreateIndexSchema(obj)
+	if err != nil {
+		t.Fatalf("CreateIndexSchema() error = %v", err)
+	}
+	tags, score := schemas[0], schemas[1]
+	if tags.FieldType != tablestore.FieldType_KEYWORD || tags.IsArray == nil || !*tags.IsArray {
+		t.Errorf("tags = %v array %v, want keyword array", tags.FieldType, tags.IsArray)
+	}
+	if score.FieldType != tablestore.FieldType_LONG || *score.EnableSortAndAgg || *score.Store {
+		t.Errorf("score = %v sortAndAgg %v store %v, want long without sort and store", score.FieldType, *score.EnableSortAndAgg, *score.Store)
+	}
+
+	if err := setIndexOptions("Tags", fieldSchema("tags", tablestore.FieldType_KEYWORD), map[string]string{"sorted": ""}); err == nil {
+		t.Error("setIndexOptions() expected error for unknown option")
+	}
+}
+
+func TestDefaultSortAndAgg(t *testing.T) {
+	obj := &struct {
+		ID      string  `json:"_id"`
+		Name    string  `json:"name"`
+		Content string  `json:"content" index:"text"`
+		Age     int64   `json:"age"`
+		Score   float64 `json:"score"`
+		Active  bool    `json:"active"`
+		Place   string  `json:"place" index:"geo"`
+	}{}
+	schemas, err := CreateIndexSchema(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"name": true, "content": false, "age": true, "score": true, "active": true, "place": true}
+	for _, schema := range schemas {
+		if *schema.EnableSortAndAgg != want[*schema.FieldName] {
+			t.Errorf("%s sortAndAgg = %v, want %v", *schema.FieldName, *schema.EnableSortAndAgg, want[*schema.FieldName])
+		}
+	}
+	if *defaultSortAndAgg(tablestore.FieldType_NESTED) {
+		t.Error("nested sortAndAgg should default to false")
+	}
+}
+
+type virtualFieldModel struct {
+	ID    string `json:"_id"`
+	Title string `json:"title" index:"text" virtual:"title_kw:keyword;title_fuzzy:text,analyzer=fuzzy,minChars=2"`
+	Code  string `json:"code" index:"-" virtual:"code_long:long,nosort"`
+}
+
+func TestCreateIndexSchemaVirtualFields(t *testing.T) {
+	schemas, err := CreateIndexSchema(&virtualFieldModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]*tablestore.FieldSchema{}
+	names := []string{}
+	for _, schema := range schemas {
+		got[*schema.FieldName] = schema
+		names = append(names, *schema.FieldName)
+	}
+	if want := []string{"title", "title_kw", "title_fuzzy", "code_long"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("fields = %v, want %v", names, want)
+	}
+
+	tests := []struct {
+		name      string
+		fieldType tablestore.FieldType
+		virtual   bool
+		source    []string
+		sortAgg   bool
+		store     bool
+	}{
+		{"title", tablestore.FieldType_TEXT, false, nil, false, true},
+		{"title_kw", tablestore.FieldType_KEYWORD, true, []string{"title"}, true, false},
+		{"title_fuzzy", tablestore.FieldType_TEXT, true, []string{"title"}, false, false},
+		{"code_long", tablestore.FieldType_LONG, true, []string{"code"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := got[tt.name]
+			if schema.FieldType != tt.fieldType {
+				t.Errorf("type = %v, want %v", schema.FieldType, tt.fieldType)
+			}
+			if boolValue(schema.IsVirtualField, false) != tt.virtual || !reflect.DeepEqual(schema.SourceFieldNames, tt.source) {
+				t.Errorf("virtual = %v %v, want %v %v", boolValue(schema.IsVirtualField, false), schema.SourceFieldNames, tt.virtual, tt.source)
+			}
+			if *schema.EnableSortAndAgg != tt.sortAgg || *schema.Store != tt.store {
+				t.Errorf("sortAndAgg, store = %v, %v, want %v, %v", *schema.EnableSortAndAgg, *schema.Store, tt.sortAgg, tt.store)
+			}
+		})
+	}
+	if got["title_fuzzy"].Analyzer == nil || *got["title_fuzzy"].Analyzer != tablestore.Analyzer_Fuzzy {
+		t.Errorf("title_fuzzy analyzer = %v, want fuzzy", got["title_fuzzy"].Analyzer)
+	}
+}
+
+func TestVirtualFieldSchemasError(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"missing type", "title_kw", "use name:type"},
+		{"empty type", "title_kw:", "type"},
+		{"unknown type", "title_kw:date", "type date"},
+		{"unknown option", "title_kw:keyword,sorted", "index option sorted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := virtualFieldSchemas("Title", "title", tt.tag)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("virtualFieldSchemas() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+type virtualFieldConflictModel struct {
+	ID    string `json:"_id"`
+	Title string `json:"title" virtual:"name:keyword"`
+	Name  string `json:"name"`
+}
+
+func TestCreateIndexSchemaVirtualFieldConflict(t *testing.T) {
+	if _, err := CreateIndexSchema(&virtualFieldConflictModel{}); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("CreateIndexSchema() error = %v, want conflict", err)
+	}
+}
+
+
+func TestDiffVirtualFieldAttributes(t *testing.T) {
+	virtual := func(sources ...string) *tablestore.FieldSchema {
+		schema := &tablestore.FieldSchema{FieldType: tablestore.FieldType_KEYWORD}
+		if len(sources) > 0 {
+			schema.IsVirtualField = proto.Bool(true)
+			schema.SourceFieldNames = sources
+		}
+		return schema
+	}
+	tests := []struct {
+		name            string
+		current, target *tablestore.FieldSchema
+		want            []string
+	}{
+		{"unchanged", virtual("title"), virtual("title"), []string{}},
+		{"to virtual", virtual(), virtual("title"), []string{"virtual"}},
+		{"to normal", virtual("title"), virtual(), []string{"virtual"}},
+		{"source changed", virtual("title"), virtual("name"), []string{"sourceFields"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffFieldAttributes(tt.current, tt.target); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffFieldAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//版本化迁移，用于AutoMigrate无法处理的数据变更，例如回填新列、拆分字段
+type Migration struct {
+	//唯一标识，按字典序执行，建议使用时间前缀，例如 202401021530_backfill_email
+	ID string
+	Up func(db *DB) error
+	//为空时不支持回滚
+	Down func(db *DB) error
+}
+
+var migrations = map[string]*Migration{}
+
+//注册迁移，一般在init中调用，ID重复时panic
+func RegisterMigration(migration *Migration) {
+	if _, ok := migrations[migration.ID]; ok {
+		panic(fmt.Sprintf("migration %s already registered", migration.ID))
+	}
+	migrations[migration.ID] = migration
+}
+
+//按ID排序的所有迁移
+func sortedMigrations() []*Migration {
+	list := []*Migration{}
+	for _, migration := range migrations {
+		list = append(list, migration)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+//已执行的迁移，与迁移锁存储在同一张表中
+//执行时间精确到微秒，回滚时按执行时间倒序
+type migrationRecord struct {
+	ID        string    `json:"_id"`
+	AppliedAt time.Time `json:"appliedAt" tableorm:"timeFormat:micro"`
+}
+
+func (migrationRecord) TableName() string {
+	return "tableorm_migrations"
+}
+
+//迁移锁，通过条件写入保证同时只有一个实例执行迁移
+//持有者崩溃时锁会在过期后被其他实例接管
+type migrationLock struct {
+	ID        string `json:"_id"`
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func (migrationLock) TableName() string {
+	return "tableorm_migrations"
+}
+
+const migrationLockID = "__lock__"
+
+//迁移的执行状态，Missing表示已执行但没有注册，可能是代码被删除
+type MigrationStatus struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time
+	Missing   bool
+}
+
+//执行所有未执行的迁移，返回本次执行的迁移ID，某个迁移失败时停止，之前执行的不会回滚
+func (db *DB) Migrate() ([]string, error) {
+	lock, err := db.lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unlockMigrations(lock)
+
+	heartbeat := db.startMigrationHeartbeat(lock)
+	defer heartbeat.stop()
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, migration := range sortedMigrations() {
+		if _, ok := applied[migration.ID]; ok {
+			continue
+		}
+
+		if err := heartbeat.err(); err != nil {
+			return ids, err
+		}
+
+		log.Printf("apply migration %s", migration.ID)
+		if err := migration.Up(db); err != nil {
+			return ids, fmt.Errorf("apply migration %s error: %w", migration.ID, err)
+		}
+		if _, err := db.Save(&migrationRecord{ID: migration.ID, AppliedAt: time.Now()}); err != nil {
+			return ids, err
+		}
+		ids = append(ids, migration.ID)
+	}
+	return ids, heartbeat.err()
+}
+
+//按执行的倒序回滚最近的steps个迁移，返回回滚的迁移ID
+func (db *DB) RollbackMigration(steps int) ([]string, error) {
+	lock, err := db.lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unlockMigrations(lock)
+
+	heartbeat := db.startMigrationHeartbeat(lock)
+	defer heartbeat.stop()
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, id := range rollbackOrder(applied) {
+		if len(ids) >= steps {
+			break
+		}
+
+		migration, ok := migrations[id]
+		if !ok {
+			return ids, fmt.Errorf("migration %s not registered", id)
+		}
+		if migration.Down == nil {
+			return ids, fmt.Errorf("migration %s does not support rollback", id)
+		}
+
+		if err := heartbeat.err(); err != nil {
+			return ids, err
+		}
+
+		log.Printf("rollback migration %s", id)
+		if err := migration.Down(db); err != nil {
+			return ids, fmt.Errorf("rollback migration %s error: %w", id, err)
+		}
+		if err := db.Delete(&migrationRecord{ID: id}); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, heartbeat.err()
+}
+
+//回滚的顺序，按执行时间倒序，同时执行的按ID倒序
+//迁移ID不一定按执行顺序递增，例如合并分支后补执行的较早ID的迁移
+func rollbackOrder(applied map[string]*migrationRecord) []string {
+	records := []*migrationRecord{}
+	for _, record := range applied {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].AppliedAt.Equal(records[j].AppliedAt) {
+			return records[i].AppliedAt.After(records[j].AppliedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+
+	ids := []string{}
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+//所有迁移的执行状态，按ID排序
+func (db *DB) MigrationStatus() ([]*MigrationStatus, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*MigrationStatus{}
+	for _, migration := range sortedMigrations() {
+		status := &MigrationStatus{ID: migration.ID}
+		if record, ok := applied[migration.ID]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for id, record := range applied {
+		if _, ok := migrations[id]; !ok {
+			statuses = append(statuses, &MigrationStatus{
+				ID:        id,
+				Applied:   true,
+				AppliedAt: record.AppliedAt,
+				Missing:   true,
+			})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses, nil
+}
+
+//读取已执行的迁移，表不存在时为空
+func (db *DB) appliedMigrations() (map[string]*migrationRecord, error) {
+	model := &migrationRecord{}
+	startPK := new(tablestore.PrimaryKey)
+	startPK.AddPrimaryKeyColumnWithMinValue("_id")
+	endPK := new(tablestore.PrimaryKey)
+	endPK.AddPrimaryKeyColumnWithMaxValue("_id")
+
+	records := map[string]*migrationRecord{}
+	for startPK != nil {
+		resp, err := db.client.GetRange(&tablestore.GetRangeRequest{
+			RangeRowQueryCriteria: &tablestore.RangeRowQueryCriteria{
+				TableName:       db.tableName(model),
+				StartPrimaryKey: startPK,
+				EndPrimaryKey:   endPK,
+				Direction:       tablestore.FORWARD,
+				MaxVersion:      1,
+			},
+		})
+		if isObjectNotExist(err) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range resp.Rows {
+			//迁移锁和索引重建锁存储在同一张表中
+			if id, _ := row.PrimaryKey.PrimaryKeys[0].Value.(string); strings.HasPrefix(id, migrationLockID) {
+				continue
+			}
+			record := &migrationRecord{}
+			if err := LoadData(record, row); err != nil {
+				return nil, err
+			}
+			records[record.ID] = record
+		}
+		startPK = resp.NextStartPrimaryKey
+	}
+	return records, nil
+}
+
+//获取迁移锁，已被其他实例持有且未过期时返回MigrationLocked
+func (db *DB) lockMigrations() (*migrationLock, error) {
+	return db.acquireLock(migrationLockID)
+}
+
+//获取指定ID的锁，迁移锁和每张表的索引重建锁使用同样的方式实现
+func (db *DB) acquireLock(id string) (*migrationLock, error) {
+	if err := db.ensureTable(&migrationLock{}); err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	token, err := DefaultIDGenerator.NewID()
+	if err != nil {
+		return nil, err
+	}
+	lock := &migrationLock{
+		ID:        id,
+		Owner:     fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), token),
+		ExpiresAt: db.migrationLockExpiresAt(),
+	}
+
+	err = db.Create(lock)
+	if err == nil {
+		return lock, nil
+	}
+	if err != RowAlreadyExist {
+		return nil, err
+	}
+
+	current := &migrationLock{ID: id}
+	if err := db.get(current, nil); err != nil && err != NotResultFound {
+		return nil, err
+	}
+	if current.ExpiresAt > time.Now().Unix() {
+		return nil, fmt.Errorf("%w: held by %s until %s", MigrationLocked, current.Owner, time.Unix(current.ExpiresAt, 0))
+	}
+
+	//锁已过期，只删除读到的那个锁，防止删除其他实例刚刚获取的锁
+	log.Printf("lock %s held by %s expired, take over", id, current.Owner)
+	if err := db.deleteMigrationLock(id, current.Owner); err != nil && !isConditionCheckFail(err) {
+		return nil, err
+	}
+	err = db.Create(lock)
+	if err == RowAlreadyExist {
+		return nil, MigrationLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+//延长迁移锁的过期时间，锁已被其他实例接管时返回错误，防止同时执行迁移
+func (db *DB) refreshMigrationLock(lock *migrationLock) error {
+	pk, err := GetPrimaryKey(lock)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := db.migrationLockExpiresAt()
+	rowChange := &tablestore.UpdateRowChange{TableName: db.tableName(lock), PrimaryKey: pk}
+	rowChange.PutColumn("expiresAt", expiresAt)
+	rowChange.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	rowChange.SetColumnCondition(tablestore.NewSingleColumnCondition("owner", tablestore.CT_EQUAL, lock.Owner))
+
+	_, err = db.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: rowChange})
+	if isConditionCheckFail(err) {
+		return fmt.Errorf("%w: lock lost", MigrationLocked)
+	}
+	if err != nil {
+		return err
+	}
+	lock.ExpiresAt = expiresAt
+	return nil
+}
+
+//迁移执行期间定期延长迁移锁，防止耗时较长的单个迁移执行时锁过期被其他实例接管
+type migrationHeartbeat struct {
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	lockErr error
+}
+
+//每隔锁超时时间的三分之一续期一次，续期失败时停止，之后的迁移不再执行
+func (db *DB) startMigrationHeartbeat(lock *migrationLock) *migrationHeartbeat {
+	h := &migrationHeartbeat{done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(h.stopped)
+		ticker := time.NewTicker(db.migrationLockTimeout() / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+				if err := db.refreshMigrationLock(lock); err != nil {
+					log.Printf("refresh migration lock error %s", err)
+					h.mu.Lock()
+					h.lockErr = err
+					h.mu.Unlock()
+					return
+				}
+			}
+		}
+	}()
+	return h
+}
+
+//续期失败的错误，锁丢失时为MigrationLocked
+func (h *migrationHeartbeat) err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lockErr
+}
+
+//停止续期，等待正在进行的续期完成后才能释放锁
+func (h *migrationHeartbeat) stop() {
+	close(h.done)
+	<-h.stopped
+}
+
+//释放迁移锁，锁已被其他实例接管时不做处理
+func (db *DB) unlockMigrations(lock *migrationLock) {
+	err := db.deleteMigrationLock(lock.ID, lock.Owner)
+	if err != nil && !isConditionCheckFail(err) {
+		log.Printf("release migration lock error %s", err)
+	}
+}
+
+//只删除owner匹配的锁
+func (db *DB) deleteMigrationLock(id, owner string) error {
+	lock := &migrationLock{ID: id}
+	pk, err := GetPrimaryKey(lock)
+	if err != nil {
+		return err
+	}
+
+	rowChange := &tablestore.DeleteRowChange{TableName: db.tableName(lock), PrimaryKey: pk}
+	rowChange.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	rowChange.SetColumnCondition(tablestore.NewSingleColumnCondition("owner", tablestore.CT_EQUAL, owner))
+
+	_, err = db.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: rowChange})
+	return err
+}
+
+func (db *DB) migrationLockTimeout() time.Duration {
+	timeout := db.migrateOptions.LockTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	return timeout
+}
+
+func (db *DB) migrationLockExpiresAt() int64 {
+	return time.Now().Add(db.migrationLockTimeout()).Unix()
+}
@@ -0,0 +1,120 @@
+package tableorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+//替换全局注册表，测试结束后恢复
+func withMigrations(t *testing.T) {
+	saved := migrations
+	migrations = map[string]*Migration{}
+	t.Cleanup(func() {
+		migrations = saved
+	})
+}
+
+func TestSortedMigrations(t *testing.T) {
+	withMigrations(t)
+	for _, id := range []string{"202401020000_b", "202401010000_a", "202401030000_c"} {
+		RegisterMigration(&Migration{ID: id, Up: func(db *DB) error { return nil }})
+	}
+
+	ids := []string{}
+	for _, migration := range sortedMigrations() {
+		ids = append(ids, migration.ID)
+	}
+	want := []string{"202401010000_a", "202401020000_b", "202401030000_c"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("sortedMigrations() = %v, want %v", ids, want)
+	}
+}
+
+func TestRegisterMigrationDuplicate(t *testing.T) {
+	withMigrations(t)
+	RegisterMigration(&Migration{ID: "202401010000_a"})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate migration should panic")
+		}
+	}()
+	RegisterMigration(&Migration{ID: "202401010000_a"})
+}
+
+func TestMigrationTableName(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk").SetNamingStrategy(NamingStrategy{TablePrefix: "app_"})
+	if got := db.tableName(&migrationRecord{}); got != "tableorm_migrations" {
+		t.Errorf("record table name = %q", got)
+	}
+	if got := db.tableName(&migrationLock{}); got != "tableorm_migrations" {
+		t.Errorf("lock table name = %q", got)
+	}
+}
+
+func TestMigrationLockExpiresAt(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	now := time.Now()
+	if got := db.migrationLockExpiresAt(); got < now.Add(30*time.Minute).Unix() || got > now.Add(31*time.Minute).Unix() {
+		t.Errorf("default expiresAt = %d, want about 30 minutes later", got)
+	}
+
+	db.SetMigrateOptions(MigrateOptions{LockTimeout: time.Minute})
+	if got := db.migrationLockExpiresAt(); got < now.Add(time.Minute).Unix() || got > now.Add(2*time.Minute).Unix() {
+		t.Errorf("expiresAt = %d, want about 1 minute later", got)
+	}
+}
+
+func TestRollbackOrder(t *testing.T) {
+	at := func(second int) time.Time {
+		return time.Date(2024, 1, 2, 15, 30, second, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		applied []*migrationRecord
+		want    []string
+	}{
+		{
+			name:    "empty",
+			applied: nil,
+			want:    []string{},
+		},
+		{
+			name: "by applied time",
+			applied: []*migrationRecord{
+				{ID: "202401010000_a", AppliedAt: at(1)},
+				{ID: "202401020000_b", AppliedAt: at(2)},
+			},
+			want: []string{"202401020000_b", "202401010000_a"},
+		},
+		{
+			name: "earlier id applied later",
+			applied: []*migrationRecord{
+				{ID: "202401020000_b", AppliedAt: at(1)},
+				{ID: "202401010000_a", AppliedAt: at(2)},
+			},
+			want: []string{"202401010000_a", "202401020000_b"},
+		},
+		{
+			name: "same applied time",
+			applied: []*migrationRecord{
+				{ID: "202401010000_a", AppliedAt: at(1)},
+				{ID: "202401020000_b", AppliedAt: at(1)},
+				{ID: "202401030000_c", AppliedAt: at(0)},
+			},
+			want: []string{"202401020000_b", "202401010000_a", "202401030000_c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := map[string]*migrationRecord{}
+			for _, record := range tt.applied {
+				applied[record.ID] = record
+			}
+			if got := rollbackOrder(applied); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rollbackOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package tableorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+//模型可以实现该接口来指定表名，优先级高于NamingStrategy，方法定义在指针上时传入结构体值也可以
+type TableNamer interface {
+	TableName() string
+}
+
+//模型可以实现该接口来指定多元索引名，优先级高于NamingStrategy，方法定义在指针上时传入结构体值也可以
+type IndexNamer interface {
+	IndexName() string
+}
+
+//表名和索引名的命名规则，零值与之前的规则一致，即表名为结构体名小写，索引名为 表名_index
+//列名不在命名规则的范围内：列名始终由json tag决定，没有json tag的字段不存入数据库，SnakeCase也不会为它们生成列名
+type NamingStrategy struct {
+	//表名前缀，例如 "app_"
+	TablePrefix string
+	//结构体名转为下划线风格，例如 UserProfile 转为 user_profile，否则直接小写为 userprofile
+	SnakeCase bool
+	//表名使用复数，例如 user 转为 users
+	PluralTable bool
+}
+
+func (ns NamingStrategy) TableName(obj interface{}) string {
+	if namer, ok := namerOf(obj).(TableNamer); ok {
+		return namer.TableName()
+	}
+
+	name := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	if ns.SnakeCase {
+		name = toSnakeCase(name)
+	} else {
+		name = strings.ToLower(name)
+	}
+	if ns.PluralTable {
+		name = pluralize(name)
+	}
+	return ns.TablePrefix + name
+}
+
+func (ns NamingStrategy) IndexName(obj interface{}) string {
+	if namer, ok := namerOf(obj).(IndexNamer); ok {
+		return namer.IndexName()
+	}
+	return fmt.Sprintf("%s_index", ns.TableName(obj))
+}
+
+//传入结构体值时复制到新的指针上，指针的方法集包含值的方法，这样两种接收者定义的命名方法都能识别
+func namerOf(obj interface{}) interface{} {
+	value := reflect.ValueOf(obj)
+	if !value.IsValid() || value.Kind() == reflect.Ptr {
+		return obj
+	}
+	ptr := reflect.New(value.Type())
+	ptr.Elem().Set(value)
+	return ptr.Interface()
+}
+
+//设置命名规则，建表、读写和查询都会使用同一个规则
+func (db *DB) SetNamingStrategy(naming NamingStrategy) *DB {
+	db.naming = naming
+	return db
+}
+
+func (db *DB) tableName(obj interface{}) string {
+	return db.naming.TableName(obj)
+}
+
+func (db *DB) indexName(obj interface{}) string {
+	return db.naming.IndexName(obj)
+}
+
+//驼峰转下划线，连续的大写视为一个单词，例如 HTTPServer 转为 http_server
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				builder.WriteByte('_')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
+
+//简单的英文复数规则，不处理不规则变化
+func pluralize(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "z"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	default:
+		return name + "s"
+	}
+}
@@ -0,0 +1,164 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"testing"
+)
+
+type namingBlogPost struct {
+	ID string `json:"_id"`
+}
+
+type namingArticle struct {
+	ID string `json:"_id"`
+}
+
+func (namingArticle) TableName() string {
+	return "articles_v2"
+}
+
+func (namingArticle) IndexName() string {
+	return "articles_search"
+}
+
+//命名方法定义在指针上，按租户分表
+type namingTenantArticle struct {
+	ID     string `json:"_id"`
+	Tenant string
+}
+
+func (a *namingTenantArticle) TableName() string {
+	return "articles_" + a.Tenant
+}
+
+func (a *namingTenantArticle) IndexName() string {
+	return "articles_" + a.Tenant + "_search"
+}
+
+func TestNamingStrategy(t *testing.T) {
+	cases := []struct {
+		name   string
+		naming NamingStrategy
+		obj    interface{}
+		table  string
+		index  string
+	}{
+		{"default", NamingStrategy{}, &namingBlogPost{}, "namingblogpost", "namingblogpost_index"},
+		{"prefix", NamingStrategy{TablePrefix: "app_"}, &namingBlogPost{}, "app_namingblogpost", "app_namingblogpost_index"},
+		{"snake", NamingStrategy{SnakeCase: true}, &namingBlogPost{}, "naming_blog_post", "naming_blog_post_index"},
+		{"plural", NamingStrategy{SnakeCase: true, PluralTable: true}, &namingBlogPost{}, "naming_blog_posts", "naming_blog_posts_index"},
+		{"value", NamingStrategy{TablePrefix: "app_"}, namingBlogPost{}, "app_namingblogpost", "app_namingblogpost_index"},
+		{"namer", NamingStrategy{TablePrefix: "app_", SnakeCase: true}, &namingArticle{}, "articles_v2", "articles_search"},
+		{"namer value", NamingStrategy{TablePrefix: "app_"}, namingArticle{}, "articles_v2", "articles_search"},
+		{"pointer namer", NamingStrategy{TablePrefix: "app_"}, &namingTenantArticle{Tenant: "acme"}, "articles_acme", "articles_acme_search"},
+		{"pointer namer value", NamingStrategy{TablePrefix: "app_"}, namingTenantArticle{Tenant: "acme"}, "articles_acme", "articles_acme_search"},
+	}
+	for _, c := range cases {
+		if got := c.naming.TableName(c.obj); got != c.table {
+			t.Errorf("%s: table name = %q, want %q", c.name, got, c.table)
+		}
+		if got := c.naming.IndexName(c.obj); got != c.index {
+			t.Errorf("%s: index name = %q, want %q", c.name, got, c.index)
+		}
+	}
+}
+
+func TestDBNamingStrategy(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	if got := db.tableName(&namingBlogPost{}); got != "namingblogpost" {
+		t.Errorf("default table name = %q", got)
+	}
+
+	db.SetNamingStrategy(NamingStrategy{TablePrefix: "app_", SnakeCase: true})
+	if got := db.tableName(&namingBlogPost{}); got != "app_naming_blog_post" {
+		t.Errorf("table name = %q", got)
+	}
+	if got := db.indexName(&namingBlogPost{}); got != "app_naming_blog_post_index" {
+		t.Errorf("index name = %q", got)
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"User":        "user",
+		"UserProfile": "user_profile",
+		"HTTPServer":  "http_server",
+		"OrderV2":     "order_v2",
+		"userID":      "user_id",
+		"":            "",
+	}
+	for in, want := range cases {
+		if got := toSnakeCase(in); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	cases := map[string]string{
+		"user":  "users",
+		"box":   "boxes",
+		"class": "classes",
+		"match": "matches",
+		"wish":  "wishes",
+		"city":  "cities",
+		"day":   "days",
+		"y":     "ys",
+	}
+	for in, want := range cases {
+		if got := pluralize(in); got != want {
+			t.Errorf("pluralize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type UserProfile struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+}
+
+func TestRowChangeTableName(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk").
+		SetNamingStrategy(NamingStrategy{TablePrefix: "app_", SnakeCase: true, PluralTable: true})
+	obj := &UserProfile{ID: "1"}
+
+	saveRowChange, err := GetSaveRowChange(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbSaveRowChange, err := db.GetSaveRowChange(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbCreateRowChange, err := db.GetCreateRowChange(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbUpdateRowChange, err := db.GetUpdateRowChange(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDeleteRowChange, err := db.GetDeleteRowChange(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		rowChange tablestore.RowChange
+		want      string
+	}{
+		{"save", saveRowChange, "userprofile"},
+		{"db save", dbSaveRowChange, "app_user_profiles"},
+		{"db create", dbCreateRowChange, "app_user_profiles"},
+		{"db update", dbUpdateRowChange, "app_user_profiles"},
+		{"db delete", dbDeleteRowChange, "app_user_profiles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rowChange.GetTableName(); got != tt.want {
+				t.Errorf("table name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package tableorm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return isIntKind(kind) || isUintKind(kind) || isFloatKind(kind)
+}
+
+//TableStore只支持int64和float64，写入前统一扩展，包括底层为数字的自定义类型
+//uint64超过int64范围时返回溢出错误
+func toColumnNumber(field string, value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch {
+	case isIntKind(v.Kind()):
+		return v.Int(), nil
+	case isUintKind(v.Kind()):
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: field %s value %d out of range of int64", ValueOverflow, field, v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case isFloatKind(v.Kind()):
+		return v.Float(), nil
+	}
+	return value, nil
+}
+
+//将读出的int64、float64转换为字段的数字类型，超出字段类型的范围时返回溢出错误
+//浮点数只能读入整数类型的字段时要求没有小数部分
+func toFieldNumber(field string, value interface{}, typ reflect.Type) (interface{}, error) {
+	result := reflect.New(typ).Elem()
+	overflow := func() error {
+		return fmt.Errorf("%w: field %s value %v out of range of %s", ValueOverflow, field, value, typ)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		switch {
+		case isIntKind(typ.Kind()):
+			if result.OverflowInt(v) {
+				return nil, overflow()
+			}
+			result.SetInt(v)
+		case isUintKind(typ.Kind()):
+			if v < 0 || result.OverflowUint(uint64(v)) {
+				return nil, overflow()
+			}
+			result.SetUint(uint64(v))
+		case isFloatKind(typ.Kind()):
+			result.SetFloat(float64(v))
+		default:
+			return nil, fmt.Errorf("field %s of type %s can not load from %T", field, typ, value)
+		}
+	case float64:
+		switch {
+		case isFloatKind(typ.Kind()):
+			if result.OverflowFloat(v) {
+				return nil, overflow()
+			}
+			result.SetFloat(v)
+		case isIntKind(typ.Kind()), isUintKind(typ.Kind()):
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("field %s of type %s can not load from fractional value %v", field, typ, v)
+			}
+			if v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, overflow()
+			}
+			return toFieldNumber(field, int64(v), typ)
+		default:
+			return nil, fmt.Errorf("field %s of type %s can not load from %T", field, typ, value)
+		}
+	default:
+		return nil, fmt.Errorf("field %s of type %s can not load from %T", field, typ, value)
+	}
+	return result.Interface(), nil
+}
@@ -0,0 +1,92 @@
+package tableorm
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type testPriority uint8
+
+func TestToColumnNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		want     interface{}
+		overflow bool
+	}{
+		{"int", 1, int64(1), false},
+		{"int8", int8(-8), int64(-8), false},
+		{"int32", int32(math.MinInt32), int64(math.MinInt32), false},
+		{"uint16", uint16(65535), int64(65535), false},
+		{"uint64 max int64", uint64(math.MaxInt64), int64(math.MaxInt64), false},
+		{"uint64 overflow", uint64(math.MaxInt64) + 1, nil, true},
+		{"float32", float32(1.5), float64(1.5), false},
+		{"custom type", testPriority(3), int64(3), false},
+		{"string unchanged", "a", "a", false},
+		{"bool unchanged", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toColumnNumber("Field", tt.value)
+			if tt.overflow {
+				if !errors.Is(err, ValueOverflow) {
+					t.Errorf("toColumnNumber() error = %v, want ValueOverflow", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("toColumnNumber() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("toColumnNumber() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToFieldNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		typ      reflect.Type
+		want     interface{}
+		overflow bool
+		err      bool
+	}{
+		{"int64 to int8", int64(-128), reflect.TypeOf(int8(0)), int8(-128), false, false},
+		{"int64 to int8 overflow", int64(128), reflect.TypeOf(int8(0)), nil, true, false},
+		{"int64 to uint8", int64(255), reflect.TypeOf(uint8(0)), uint8(255), false, false},
+		{"negative to uint", int64(-1), reflect.TypeOf(uint(0)), nil, true, false},
+		{"int64 to custom type", int64(3), reflect.TypeOf(testPriority(0)), testPriority(3), false, false},
+		{"int64 to float32", int64(2), reflect.TypeOf(float32(0)), float32(2), false, false},
+		{"float64 to float32", float64(1.5), reflect.TypeOf(float32(0)), float32(1.5), false, false},
+		{"float64 to float32 overflow", math.MaxFloat64, reflect.TypeOf(float32(0)), nil, true, false},
+		{"integral float64 to int", float64(42), reflect.TypeOf(0), 42, false, false},
+		{"fractional float64 to int", float64(1.5), reflect.TypeOf(0), nil, false, true},
+		{"float64 to int64 overflow", float64(math.MaxInt64), reflect.TypeOf(int64(0)), nil, true, false},
+		{"float64 to uint16 overflow", float64(70000), reflect.TypeOf(uint16(0)), nil, true, false},
+		{"string to int", "1", reflect.TypeOf(0), nil, false, true},
+		{"int64 to string", int64(1), reflect.TypeOf(""), nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toFieldNumber("Field", tt.value, tt.typ)
+			switch {
+			case tt.overflow:
+				if !errors.Is(err, ValueOverflow) {
+					t.Errorf("toFieldNumber() error = %v, want ValueOverflow", err)
+				}
+			case tt.err:
+				if err == nil || errors.Is(err, ValueOverflow) {
+					t.Errorf("toFieldNumber() error = %v, want conversion error", err)
+				}
+			case err != nil:
+				t.Errorf("toFieldNumber() error = %v", err)
+			case got != tt.want:
+				t.Errorf("toFieldNumber() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
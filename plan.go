@@ -0,0 +1,202 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+)
+
+//索引的变更操作
+type IndexAction string
+
+const (
+	IndexUnchanged IndexAction = "unchanged"
+	IndexCreate    IndexAction = "create"
+	IndexRebuild   IndexAction = "rebuild"
+)
+
+//表级配置的变更
+type TableOptionsChange struct {
+	From TableOptions
+	To   TableOptions
+}
+
+//单个模型的迁移计划
+type ModelPlan struct {
+	Table string
+	//当前使用的索引，重建时会创建新版本的索引并切换
+	Index       string
+	CreateTable bool
+	//为空表示表级配置没有变化
+	TableOptions *TableOptionsChange
+	IndexAction  IndexAction
+	FieldChanges []*FieldChange
+	//路由字段或预排序有变化
+	IndexOptionsChanged bool
+	//需要创建的全局二级索引
+	CreateSecondaryIndexes []string
+}
+
+func (p *ModelPlan) HasChanges() bool {
+	return p.CreateTable || p.TableOptions != nil || p.IndexAction != IndexUnchanged || len(p.CreateSecondaryIndexes) > 0
+}
+
+//AutoMigrate将要执行的操作，只读取表和索引的信息，不做任何修改
+type MigrationPlan struct {
+	Models []*ModelPlan
+}
+
+func (p *MigrationPlan) HasChanges() bool {
+	for _, model := range p.Models {
+		if model.HasChanges() {
+			return true
+		}
+	}
+	return false
+}
+
+//便于在CI中输出和审查
+func (p *MigrationPlan) String() string {
+	var b strings.Builder
+	for _, model := range p.Models {
+		if !model.HasChanges() {
+			fmt.Fprintf(&b, "table %s: no changes\n", model.Table)
+			continue
+		}
+
+		if model.CreateTable {
+			fmt.Fprintf(&b, "table %s: create table\n", model.Table)
+		}
+		if change := model.TableOptions; change != nil {
+			fmt.Fprintf(&b, "table %s: update options %+v -> %+v\n", model.Table, change.From, change.To)
+		}
+		for _, name := range model.CreateSecondaryIndexes {
+			fmt.Fprintf(&b, "table %s: create secondary index %s\n", model.Table, name)
+		}
+		if model.IndexAction != IndexUnchanged {
+			fmt.Fprintf(&b, "table %s: %s index %s\n", model.Table, model.IndexAction, model.Index)
+		}
+		if model.IndexOptionsChanged {
+			fmt.Fprintf(&b, "  ~ routing fields or index sort\n")
+		}
+		for _, change := range model.FieldChanges {
+			switch change.Type {
+			case FieldAdded:
+				fmt.Fprintf(&b, "  + %s %s\n", change.Field, fieldTypeName(change.To.FieldType))
+			case FieldRemoved:
+				fmt.Fprintf(&b, "  - %s %s\n", change.Field, fieldTypeName(change.From.FieldType))
+			case FieldRetyped:
+				fmt.Fprintf(&b, "  ~ %s %s -> %s\n", change.Field, fieldTypeName(change.From.FieldType), fieldTypeName(change.To.FieldType))
+			default:
+				fmt.Fprintf(&b, "  ~ %s %v\n", change.Field, change.Attributes)
+			}
+		}
+	}
+	return b.String()
+}
+
+var fieldTypeNames = map[tablestore.FieldType]string{
+	tablestore.FieldType_LONG:      "long",
+	tablestore.FieldType_DOUBLE:    "double",
+	tablestore.FieldType_BOOLEAN:   "boolean",
+	tablestore.FieldType_KEYWORD:   "keyword",
+	tablestore.FieldType_TEXT:      "text",
+	tablestore.FieldType_NESTED:    "nested",
+	tablestore.FieldType_GEO_POINT: "geo_point",
+}
+
+func fieldTypeName(fieldType tablestore.FieldType) string {
+	if name, ok := fieldTypeNames[fieldType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", fieldType)
+}
+
+//生成迁移计划，与AutoMigrate的判断逻辑一致
+func (db *DB) MigrationPlan(models ...interface{}) (*MigrationPlan, error) {
+	plan := &MigrationPlan{}
+	for _, obj := range models {
+		modelPlan, err := db.planModel(obj)
+		if err != nil {
+			return nil, fmt.Errorf("plan model %s error: %w", db.tableName(obj), err)
+		}
+		plan.Models = append(plan.Models, modelPlan)
+	}
+	return plan, nil
+}
+
+func (db *DB) planModel(obj interface{}) (*ModelPlan, error) {
+	err := CheckModel(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	targetSchema, err := CreateIndexSchemaWithOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	indexName, err := db.activeIndexName(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ModelPlan{
+		Table:       db.tableName(obj),
+		Index:       indexName,
+		IndexAction: IndexUnchanged,
+	}
+
+	tableExist, err := db.isTableExist(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.CreateSecondaryIndexes, err = db.planSecondaryIndexes(obj, tableExist)
+	if err != nil {
+		return nil, err
+	}
+
+	//表不存在时表和索引都需要创建
+	if !tableExist {
+		plan.CreateTable = true
+		plan.IndexAction = IndexCreate
+		plan.FieldChanges = DiffIndexSchema(nil, targetSchema).Fields
+		return plan, nil
+	}
+
+	options, err := GetTableOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+	current, err := db.getCurrentTableOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+	if *current != *options {
+		plan.TableOptions = &TableOptionsChange{From: *current, To: *options}
+	}
+
+	indexExist, err := db.isIndexExist(obj, indexName)
+	if err != nil {
+		return nil, err
+	}
+	if !indexExist {
+		plan.IndexAction = IndexCreate
+		plan.FieldChanges = DiffIndexSchema(nil, targetSchema).Fields
+		return plan, nil
+	}
+
+	currentSchema, err := db.getIndexSchema(obj, indexName)
+	if err != nil {
+		return nil, err
+	}
+	diff := DiffIndexSchema(currentSchema, targetSchema)
+	if diff.HasChanges() {
+		plan.IndexAction = IndexRebuild
+		plan.FieldChanges = diff.Fields
+		plan.IndexOptionsChanged = diff.RoutingFieldsChanged || diff.IndexSortChanged
+	}
+
+	return plan, nil
+}
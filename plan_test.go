@@ -0,0 +1,65 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/golang/protobuf/proto"
+	"testing"
+)
+
+func fieldSchema(name string, fieldType tablestore.FieldType) *tablestore.FieldSchema {
+	return &tablestore.FieldSchema{FieldName: proto.String(name), FieldType: fieldType}
+}
+
+func TestMigrationPlanString(t *testing.T) {
+	modified := fieldSchema("score", tablestore.FieldType_LONG)
+	modified.EnableSortAndAgg = proto.Bool(true)
+
+	plan := &MigrationPlan{Models: []*ModelPlan{
+		{Table: "user", Index: "user_index", IndexAction: IndexUnchanged},
+		{
+			Table:                  "book",
+			Index:                  "book_index",
+			CreateTable:            true,
+			CreateSecondaryIndexes: []string{"caption_idx"},
+			IndexAction:            IndexCreate,
+			FieldChanges: []*FieldChange{
+				{Field: "title", Type: FieldAdded, To: fieldSchema("title", tablestore.FieldType_TEXT)},
+			},
+		},
+		{
+			Table:               "order",
+			Index:               "order_index_v2",
+			TableOptions:        &TableOptionsChange{From: TableOptions{TimeToAlive: -1, MaxVersion: 1}, To: TableOptions{TimeToAlive: 86400, MaxVersion: 1}},
+			IndexAction:         IndexRebuild,
+			IndexOptionsChanged: true,
+			FieldChanges: []*FieldChange{
+				{Field: "price", Type: FieldRetyped, From: fieldSchema("price", tablestore.FieldType_LONG), To: fieldSchema("price", tablestore.FieldType_DOUBLE)},
+				{Field: "score", Type: FieldModified, From: fieldSchema("score", tablestore.FieldType_LONG), To: modified, Attributes: []string{"sortAndAgg"}},
+				{Field: "memo", Type: FieldRemoved, From: fieldSchema("memo", tablestore.FieldType_KEYWORD)},
+			},
+		},
+	}}
+
+	want := "table user: no changes\n" +
+		"table book: create table\n" +
+		"table book: create secondary index caption_idx\n" +
+		"table book: create index book_index\n" +
+		"  + title text\n" +
+		"table order: update options {TimeToAlive:-1 MaxVersion:1 ReservedRead:0 ReservedWrite:0} -> {TimeToAlive:86400 MaxVersion:1 ReservedRead:0 ReservedWrite:0}\n" +
+		"table order: rebuild index order_index_v2\n" +
+		"  ~ routing fields or index sort\n" +
+		"  ~ price long -> double\n" +
+		"  ~ score [sortAndAgg]\n" +
+		"  - memo keyword\n"
+	if got := plan.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+	if !plan.HasChanges() {
+		t.Error("HasChanges() = false, want true")
+	}
+
+	unchanged := &MigrationPlan{Models: plan.Models[:1]}
+	if unchanged.HasChanges() {
+		t.Error("HasChanges() = true, want false")
+	}
+}
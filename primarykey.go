@@ -0,0 +1,273 @@
+package tableorm
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/oleiade/reflections"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+//TableStore最多支持4个主键列
+const maxPrimaryKeyColumns = 4
+
+//哈希前缀长度，4位十六进制，共65536个取值，足够将连续ID打散到不同分区
+const hashPrefixLength = 4
+
+//主键列，按主键顺序排列，第一个为分区键
+type primaryKeyField struct {
+	Field  string
+	Column string
+	//为空时主键值必须由调用方设置
+	Generator IDGenerator
+}
+
+//获取模型的主键列
+//通过 pk:"1"、pk:"2" 指定复合主键及顺序，没有pk tag时约定 _id 为唯一的主键
+func getPrimaryKeyFields(obj interface{}) ([]*primaryKeyField, error) {
+	fieldToJSONMap, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := getModelFieldNames(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := map[int]*primaryKeyField{}
+	for _, field := range fields {
+		tag, _ := reflections.GetFieldTag(obj, field, "pk")
+		if tag == "" {
+			continue
+		}
+
+		column := fieldToJSONMap[field]
+		if column == "" {
+			return nil, fmt.Errorf("primary key field %s must have json tag", field)
+		}
+		order, err := strconv.Atoi(tag)
+		if err != nil || order < 1 || order > maxPrimaryKeyColumns {
+			return nil, fmt.Errorf("unexpected primary key order %s %s, must be 1-%d", field, tag, maxPrimaryKeyColumns)
+		}
+		if _, ok := orders[order]; ok {
+			return nil, fmt.Errorf("duplicate primary key order %s %s", field, tag)
+		}
+		orders[order] = &primaryKeyField{Field: field, Column: column}
+	}
+
+	pkFields := []*primaryKeyField{}
+	if len(orders) == 0 {
+		field, ok := jsonToFieldMap["_id"]
+		if !ok {
+			return nil, IDFieldNotExist
+		}
+		pkFields = append(pkFields, &primaryKeyField{Field: field, Column: "_id"})
+	} else {
+		keys := []int{}
+		for order := range orders {
+			keys = append(keys, order)
+		}
+		sort.Ints(keys)
+		for i, order := range keys {
+			if order != i+1 {
+				return nil, fmt.Errorf("primary key order must be continuous from 1, missing %d", i+1)
+			}
+			pkFields = append(pkFields, orders[order])
+		}
+	}
+
+	for _, pkField := range pkFields {
+		pkField.Generator, err = getFieldIDGenerator(obj, pkField)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pkFields, nil
+}
+
+//模型级别的tag写在分区键（第一个主键列）上，例如 tableorm:"hashPrefix;ttl:86400"
+func getModelTag(obj interface{}) (map[string]string, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, _ := reflections.GetFieldTag(obj, pkFields[0].Field, "tableorm")
+	return parseTableormTag(tag), nil
+}
+
+//主键列的Go类型对应的TableStore主键类型
+func getPrimaryKeyType(obj interface{}, pkField *primaryKeyField) (tablestore.PrimaryKeyType, error) {
+	value, err := reflections.GetField(obj, pkField.Field)
+	if err != nil {
+		return 0, err
+	}
+
+	switch value.(type) {
+	case string:
+		return tablestore.PrimaryKeyType_STRING, nil
+	case int64:
+		return tablestore.PrimaryKeyType_INTEGER, nil
+	case []byte:
+		return tablestore.PrimaryKeyType_BINARY, nil
+	default:
+		return 0, fmt.Errorf("primary key %s must be one of (string,int64,[]byte), it's %T now", pkField.Field, value)
+	}
+}
+
+//模型是否开启了主键哈希前缀，在分区键字段上通过 tableorm:"hashPrefix" 开启
+//开启后实际存储的分区键为 "ab12:" + 原始值，读取时自动去掉前缀，对业务代码透明
+func hasHashPrefix(obj interface{}) (bool, error) {
+	settings, err := getModelTag(obj)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := settings["hashPrefix"]
+	return ok, nil
+}
+
+//给ID加上哈希前缀，前缀取自ID的md5，相同ID总是得到相同前缀
+func AddHashPrefix(id string) string {
+	sum := md5.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])[:hashPrefixLength] + ":" + id
+}
+
+//去掉ID的哈希前缀，前缀与ID不匹配时原样返回
+func StripHashPrefix(id string) string {
+	if len(id) <= hashPrefixLength || id[hashPrefixLength] != ':' {
+		return id
+	}
+
+	raw := id[hashPrefixLength+1:]
+	if AddHashPrefix(raw) != id {
+		return id
+	}
+	return raw
+}
+
+//将业务上的分区键转换为实际存储的值
+func encodeID(obj interface{}, id interface{}) (interface{}, error) {
+	hashPrefix, err := hasHashPrefix(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !hashPrefix {
+		return id, nil
+	}
+
+	s, ok := id.(string)
+	if !ok {
+		return nil, fmt.Errorf("hash prefix only support string partition key, it's %T now", id)
+	}
+	return AddHashPrefix(s), nil
+}
+
+//将存储的分区键还原为业务上的值
+func decodeID(obj interface{}, value interface{}) (interface{}, error) {
+	hashPrefix, err := hasHashPrefix(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := value.(string)
+	if !hashPrefix || !ok {
+		return value, nil
+	}
+	return StripHashPrefix(s), nil
+}
+
+//读取obj中的主键值，按主键顺序排列
+func GetPrimaryKeyValues(obj interface{}) ([]interface{}, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	for _, pkField := range pkFields {
+		value, err := reflections.GetField(obj, pkField.Field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+//根据obj中的主键值构造主键，用于读取、更新和删除
+func GetPrimaryKey(obj interface{}) (*tablestore.PrimaryKey, error) {
+	values, err := GetPrimaryKeyValues(obj)
+	if err != nil {
+		return nil, err
+	}
+	return buildPrimaryKey(obj, values...)
+}
+
+//根据主键值构造obj对应表的主键，values按主键顺序排列
+func buildPrimaryKey(obj interface{}, values ...interface{}) (*tablestore.PrimaryKey, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(pkFields) {
+		return nil, fmt.Errorf("table %s has %d primary key columns, got %d values", GetTableName(obj), len(pkFields), len(values))
+	}
+
+	pk := new(tablestore.PrimaryKey)
+	for i, pkField := range pkFields {
+		value := values[i]
+		if i == 0 {
+			value, err = encodeID(obj, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pk.AddPrimaryKeyColumn(pkField.Column, value)
+	}
+	return pk, nil
+}
+
+//构造只包含分区键的主键，用于开启局部事务
+func buildPartitionKey(obj interface{}, value interface{}) (*tablestore.PrimaryKey, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = encodeID(obj, value)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(pkFields[0].Column, value)
+	return pk, nil
+}
+
+//检查需要生成的主键是否为空，值的拷贝无法回填生成的主键
+func hasEmptyGeneratedKey(obj interface{}) (bool, error) {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pkField := range pkFields {
+		if pkField.Generator == nil {
+			continue
+		}
+		value, err := reflections.GetField(obj, pkField.Field)
+		if err != nil {
+			return false, err
+		}
+		if reflect.ValueOf(value).IsZero() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,256 @@
+package tableorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+type hashPrefixUser struct {
+	ID   string `json:"_id" tableorm:"hashPrefix"`
+	Name string `json:"name"`
+}
+
+type plainUser struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+}
+
+type hashPrefixMetric struct {
+	Tenant int64  `json:"tenant" pk:"1" tableorm:"hashPrefix"`
+	Name   string `json:"name" pk:"2"`
+}
+
+type hashPrefixEvent struct {
+	Tenant string `json:"tenant" pk:"1" tableorm:"hashPrefix"`
+	Ts     int64  `json:"ts" pk:"2"`
+	Seq    int64  `json:"seq" pk:"3" tableorm:"idGenerator:autoIncrement"`
+}
+
+func TestEncodeDecodeID(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     interface{}
+		id      interface{}
+		encoded interface{}
+	}{
+		{"hash prefix", &hashPrefixUser{}, "user-1", AddHashPrefix("user-1")},
+		{"hash prefix empty id", &hashPrefixUser{}, "", AddHashPrefix("")},
+		{"id with colon", &hashPrefixUser{}, "a:b", AddHashPrefix("a:b")},
+		{"no hash prefix", &plainUser{}, "user-1", "user-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := encodeID(tt.obj, tt.id)
+			if err != nil {
+				t.Fatalf("encodeID() error = %v", err)
+			}
+			if encoded != tt.encoded {
+				t.Errorf("encodeID() = %v, want %v", encoded, tt.encoded)
+			}
+			decoded, err := decodeID(tt.obj, encoded)
+			if err != nil {
+				t.Fatalf("decodeID() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.id) {
+				t.Errorf("decodeID() = %v, want %v", decoded, tt.id)
+			}
+		})
+	}
+}
+
+func TestEncodeIDRequiresString(t *testing.T) {
+	if _, err := encodeID(&hashPrefixMetric{}, int64(1)); err == nil {
+		t.Error("encodeID() expected error for int64 partition key")
+	}
+}
+
+func TestStripHashPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"prefixed", AddHashPrefix("user-1"), "user-1"},
+		{"raw", "user-1", "user-1"},
+		{"short", "ab:", "ab:"},
+		//前缀与ID不匹配时视为原始ID，例如本身就包含冒号的ID
+		{"mismatched prefix", "0000:user-1", "0000:user-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripHashPrefix(tt.id); got != tt.want {
+				t.Errorf("StripHashPrefix(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHashPrefixIsStable(t *testing.T) {
+	first, second := AddHashPrefix("user-1"), AddHashPrefix("user-1")
+	if first != second {
+		t.Errorf("AddHashPrefix() not stable: %q, %q", first, second)
+	}
+	if first[hashPrefixLength] != ':' || first[hashPrefixLength+1:] != "user-1" {
+		t.Errorf("AddHashPrefix() = %q, want prefix of length %d", first, hashPrefixLength)
+	}
+}
+
+func TestGetPrimaryKeyFields(t *testing.T) {
+	obj := &struct {
+		Seq    int64  `json:"seq" pk:"3" tableorm:"idGenerator:autoIncrement"`
+		Tenant string `json:"tenant" pk:"1"`
+		Ts     int64  `json:"ts" pk:"2"`
+		Value  string `json:"value"`
+	}{}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		t.Fatalf("getPrimaryKeyFields() error = %v", err)
+	}
+	wantColumns := []string{"tenant", "ts", "seq"}
+	if len(pkFields) != len(wantColumns) {
+		t.Fatalf("getPrimaryKeyFields() returned %d columns, want %d", len(pkFields), len(wantColumns))
+	}
+	for i, column := range wantColumns {
+		if pkFields[i].Column != column {
+			t.Errorf("pkFields[%d].Column = %s, want %s", i, pkFields[i].Column, column)
+		}
+	}
+	if pkFields[0].Generator != nil || pkFields[1].Generator != nil {
+		t.Error("primary key columns other than _id should not be generated without tag")
+	}
+	if !isAutoIncrement(pkFields[2].Generator) {
+		t.Errorf("pkFields[2].Generator = %T, want AutoIncrementGenerator", pkFields[2].Generator)
+	}
+
+	pkFields, err = getPrimaryKeyFields(&plainUser{})
+	if err != nil {
+		t.Fatalf("getPrimaryKeyFields() error = %v", err)
+	}
+	if len(pkFields) != 1 || pkFields[0].Column != "_id" || pkFields[0].Generator != DefaultIDGenerator {
+		t.Errorf("getPrimaryKeyFields() without pk tag = %+v, want _id with default generator", pkFields[0])
+	}
+}
+
+func TestGetPrimaryKeyFieldsError(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+	}{
+		{"missing order", &struct {
+			A string `json:"a" pk:"1"`
+			B string `json:"b" pk:"3"`
+		}{}},
+		{"duplicate order", &struct {
+			A string `json:"a" pk:"1"`
+			B string `json:"b" pk:"1"`
+		}{}},
+		{"order out of range", &struct {
+			A string `json:"a" pk:"5"`
+		}{}},
+		{"order not number", &struct {
+			A string `json:"a" pk:"first"`
+		}{}},
+		{"without json tag", &struct {
+			A string `pk:"1"`
+		}{}},
+		{"without _id", &struct {
+			A string `json:"a"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := getPrimaryKeyFields(tt.obj); err == nil {
+				t.Error("getPrimaryKeyFields() expected error")
+			}
+		})
+	}
+}
+
+func TestCheckModelPrimaryKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     interface{}
+		wantErr bool
+	}{
+		{"composite", &hashPrefixEvent{}, false},
+		{"binary", &struct {
+			A []byte `json:"a" pk:"1"`
+		}{}, false},
+		{"float", &struct {
+			A float64 `json:"a" pk:"1"`
+		}{}, true},
+		{"auto increment partition key", &struct {
+			A int64 `json:"a" pk:"1" tableorm:"idGenerator:autoIncrement"`
+		}{}, true},
+		{"auto increment string", &struct {
+			A string `json:"a" pk:"1"`
+			B string `json:"b" pk:"2" tableorm:"idGenerator:autoIncrement"`
+		}{}, true},
+		{"generated int64", &struct {
+			A string `json:"a" pk:"1"`
+			B int64  `json:"b" pk:"2" tableorm:"idGenerator:ulid"`
+		}{}, true},
+		{"int64 _id", &struct {
+			ID int64 `json:"_id"`
+		}{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckModel(tt.obj); (err != nil) != tt.wantErr {
+				t.Errorf("CheckModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildPrimaryKey(t *testing.T) {
+	pk, err := buildPrimaryKey(&hashPrefixEvent{}, "tenant-1", int64(10), int64(3))
+	if err != nil {
+		t.Fatalf("buildPrimaryKey() error = %v", err)
+	}
+	want := []struct {
+		column string
+		value  interface{}
+	}{
+		{"tenant", AddHashPrefix("tenant-1")},
+		{"ts", int64(10)},
+		{"seq", int64(3)},
+	}
+	for i, w := range want {
+		column := pk.PrimaryKeys[i]
+		if column.ColumnName != w.column || column.Value != w.value {
+			t.Errorf("PrimaryKeys[%d] = %s=%v, want %s=%v", i, column.ColumnName, column.Value, w.column, w.value)
+		}
+	}
+
+	if _, err := buildPrimaryKey(&hashPrefixEvent{}, "tenant-1"); err == nil {
+		t.Error("buildPrimaryKey() expected error for missing values")
+	}
+}
+
+//局部事务的分区键只包含第一个主键列，并且同样加上哈希前缀
+func TestBuildPartitionKey(t *testing.T) {
+	pk, err := buildPartitionKey(&hashPrefixEvent{}, "tenant-1")
+	if err != nil {
+		t.Fatalf("buildPartitionKey() error = %v", err)
+	}
+	if len(pk.PrimaryKeys) != 1 {
+		t.Fatalf("buildPartitionKey() returned %d columns, want 1", len(pk.PrimaryKeys))
+	}
+	if column := pk.PrimaryKeys[0]; column.ColumnName != "tenant" || column.Value != AddHashPrefix("tenant-1") {
+		t.Errorf("buildPartitionKey() = %s=%v, want tenant=%s", column.ColumnName, column.Value, AddHashPrefix("tenant-1"))
+	}
+
+	pk, err = buildPartitionKey(&plainUser{}, "user-1")
+	if err != nil {
+		t.Fatalf("buildPartitionKey() error = %v", err)
+	}
+	if column := pk.PrimaryKeys[0]; column.ColumnName != "_id" || column.Value != "user-1" {
+		t.Errorf("buildPartitionKey() = %s=%v, want _id=user-1", column.ColumnName, column.Value)
+	}
+
+	if _, err := buildPartitionKey(&hashPrefixMetric{}, int64(1)); err == nil {
+		t.Error("buildPartitionKey() expected error for int64 hash prefix partition key")
+	}
+}
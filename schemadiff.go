@@ -0,0 +1,218 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"reflect"
+	"sort"
+)
+
+//索引字段的变更类型
+type FieldChangeType string
+
+const (
+	FieldAdded    FieldChangeType = "added"
+	FieldRemoved  FieldChangeType = "removed"
+	FieldRetyped  FieldChangeType = "retyped"
+	FieldModified FieldChangeType = "modified"
+)
+
+//索引字段的变更，新增时From为空，删除时To为空
+//嵌套字段的子字段名为 父字段.子字段
+type FieldChange struct {
+	Field string
+	Type  FieldChangeType
+	From  *tablestore.FieldSchema
+	To    *tablestore.FieldSchema
+	//修改时有变化的属性，例如 store、sortAndAgg、array、virtual、analyzer
+	Attributes []string
+}
+
+//已有索引与模型定义之间的实际差异，忽略字段顺序和服务端填充的默认值
+type IndexSchemaDiff struct {
+	Fields               []*FieldChange
+	RoutingFieldsChanged bool
+	IndexSortChanged     bool
+}
+
+func (d *IndexSchemaDiff) HasChanges() bool {
+	return len(d.Fields) > 0 || d.RoutingFieldsChanged || d.IndexSortChanged
+}
+
+//对比当前使用的索引与模型定义，索引不存在时返回错误
+func (db *DB) IndexSchemaDiff(obj interface{}) (*IndexSchemaDiff, error) {
+	indexName, err := db.activeIndexName(obj)
+	if err != nil {
+		return nil, err
+	}
+	return db.indexSchemaDiff(obj, indexName)
+}
+
+func (db *DB) indexSchemaDiff(obj interface{}, indexName string) (*IndexSchemaDiff, error) {
+	currentSchema, err := db.getIndexSchema(obj, indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	targetSchema, err := CreateIndexSchemaWithOptions(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffIndexSchema(currentSchema, targetSchema), nil
+}
+
+//对比两个索引schema，current为空时所有字段都是新增
+func DiffIndexSchema(current, target *tablestore.IndexSchema) *IndexSchemaDiff {
+	if current == nil {
+		current = &tablestore.IndexSchema{}
+	}
+
+	return &IndexSchemaDiff{
+		Fields:               diffFieldSchemas("", current.FieldSchemas, target.FieldSchemas),
+		RoutingFieldsChanged: !reflect.DeepEqual(routingFields(current), routingFields(target)),
+		IndexSortChanged:     !reflect.DeepEqual(indexSort(current), indexSort(target)),
+	}
+}
+
+//没有指定时服务端默认为无路由字段
+func routingFields(schema *tablestore.IndexSchema) []string {
+	if schema.IndexSetting == nil || len(schema.IndexSetting.RoutingFields) == 0 {
+		return []string{}
+	}
+	return schema.IndexSetting.RoutingFields
+}
+
+//没有指定时服务端默认按主键升序
+func indexSort(schema *tablestore.IndexSchema) []search.Sorter {
+	if schema.IndexSort == nil || len(schema.IndexSort.Sorters) == 0 {
+		return []search.Sorter{search.NewPrimaryKeySort()}
+	}
+	return schema.IndexSort.Sorters
+}
+
+//按字段名对比，结果按字段名排序
+func diffFieldSchemas(prefix string, current, target []*tablestore.FieldSchema) []*FieldChange {
+	currentMap := map[string]*tablestore.FieldSchema{}
+	for _, schema := range current {
+		currentMap[*schema.FieldName] = schema
+	}
+	targetMap := map[string]*tablestore.FieldSchema{}
+	for _, schema := range target {
+		targetMap[*schema.FieldName] = schema
+	}
+
+	changes := []*FieldChange{}
+	for name, to := range targetMap {
+		field := prefix + name
+		from, ok := currentMap[name]
+		switch {
+		case !ok:
+			changes = append(changes, &FieldChange{Field: field, Type: FieldAdded, To: to})
+		case from.FieldType != to.FieldType:
+			changes = append(changes, &FieldChange{Field: field, Type: FieldRetyped, From: from, To: to})
+		default:
+			if attributes := diffFieldAttributes(from, to); len(attributes) > 0 {
+				changes = append(changes, &FieldChange{Field: field, Type: FieldModified, From: from, To: to, Attributes: attributes})
+			}
+			//嵌套字段对比子字段
+			if to.FieldType == tablestore.FieldType_NESTED {
+				changes = append(changes, diffFieldSchemas(field+".", from.FieldSchemas, to.FieldSchemas)...)
+			}
+		}
+	}
+	for name, from := range currentMap {
+		if _, ok := targetMap[name]; !ok {
+			changes = append(changes, &FieldChange{Field: prefix + name, Type: FieldRemoved, From: from})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+//对比同类型字段的属性
+//模型中没有指定的属性使用服务端的默认值，不参与对比，nil与默认值视为相同
+func diffFieldAttributes(current, target *tablestore.FieldSchema) []string {
+	attributes := []string{}
+	boolChanged := func(current, target *bool, defaultValue bool) bool {
+		if target == nil {
+			return false
+		}
+		return boolValue(current, defaultValue) != *target
+	}
+
+	if boolChanged(current.Index, target.Index, true) {
+		attributes = append(attributes, "index")
+	}
+	if target.IndexOptions != nil && (current.IndexOptions == nil || *current.IndexOptions != *target.IndexOptions) {
+		attributes = append(attributes, "indexOptions")
+	}
+	if boolChanged(current.EnableSortAndAgg, target.EnableSortAndAgg, false) {
+		attributes = append(attributes, "sortAndAgg")
+	}
+	if boolChanged(current.Store, target.Store, true) {
+		attributes = append(attributes, "store")
+	}
+	//数组需要显式声明，没有声明即为非数组
+	if boolValue(current.IsArray, false) != boolValue(target.IsArray, false) {
+		attributes = append(attributes, "array")
+	}
+	//虚拟列与普通字段同名时也视为变化，来源列不同时需要重建
+	if boolValue(current.IsVirtualField, false) != boolValue(target.IsVirtualField, false) {
+		attributes = append(attributes, "virtual")
+	} else if boolValue(target.IsVirtualField, false) && !reflect.DeepEqual(current.SourceFieldNames, target.SourceFieldNames) {
+		attributes = append(attributes, "sourceFields")
+	}
+
+	if target.FieldType == tablestore.FieldType_TEXT {
+		currentAnalyzer, currentParameter := normalizeAnalyzer(current)
+		targetAnalyzer, targetParameter := normalizeAnalyzer(target)
+		if currentAnalyzer != targetAnalyzer {
+			attributes = append(attributes, "analyzer")
+		} else if !reflect.DeepEqual(currentParameter, targetParameter) {
+			attributes = append(attributes, "analyzerParameter")
+		}
+	}
+	return attributes
+}
+
+//补全分词器及参数的默认值，TEXT字段默认使用single_word分词
+func normalizeAnalyzer(schema *tablestore.FieldSchema) (tablestore.Analyzer, interface{}) {
+	analyzer := tablestore.Analyzer_SingleWord
+	if schema.Analyzer != nil {
+		analyzer = *schema.Analyzer
+	}
+
+	switch analyzer {
+	case tablestore.Analyzer_SingleWord:
+		param, _ := schema.AnalyzerParameter.(tablestore.SingleWordAnalyzerParameter)
+		return analyzer, []bool{boolValue(param.CaseSensitive, false), boolValue(param.DelimitWord, false)}
+	case tablestore.Analyzer_Split:
+		param, _ := schema.AnalyzerParameter.(tablestore.SplitAnalyzerParameter)
+		if param.Delimiter == nil {
+			return analyzer, nil
+		}
+		return analyzer, *param.Delimiter
+	case tablestore.Analyzer_Fuzzy:
+		param, _ := schema.AnalyzerParameter.(tablestore.FuzzyAnalyzerParameter)
+		if param.MinChars == 0 {
+			param.MinChars = defaultFuzzyMinChars
+		}
+		if param.MaxChars == 0 {
+			param.MaxChars = defaultFuzzyMaxChars
+		}
+		return analyzer, param
+	}
+	return analyzer, nil
+}
+
+//未设置的bool属性取默认值
+func boolValue(b *bool, defaultValue bool) bool {
+	if b == nil {
+		return defaultValue
+	}
+	return *b
+}
@@ -0,0 +1,153 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+func TestDiffIndexSchemaFields(t *testing.T) {
+	withStore := func(schema *tablestore.FieldSchema, store bool) *tablestore.FieldSchema {
+		schema.Store = proto.Bool(store)
+		return schema
+	}
+	withAnalyzer := func(schema *tablestore.FieldSchema, analyzer tablestore.Analyzer, parameter interface{}) *tablestore.FieldSchema {
+		schema.Analyzer = &analyzer
+		schema.AnalyzerParameter = parameter
+		return schema
+	}
+	nested := func(name string, fields ...*tablestore.FieldSchema) *tablestore.FieldSchema {
+		schema := fieldSchema(name, tablestore.FieldType_NESTED)
+		schema.FieldSchemas = fields
+		return schema
+	}
+
+	type change struct {
+		Field      string
+		Type       FieldChangeType
+		Attributes []string
+	}
+	tests := []struct {
+		name    string
+		current []*tablestore.FieldSchema
+		target  []*tablestore.FieldSchema
+		want    []change
+	}{
+		{
+			name:    "same fields in different order",
+			current: []*tablestore.FieldSchema{fieldSchema("age", tablestore.FieldType_LONG), fieldSchema("name", tablestore.FieldType_KEYWORD)},
+			target:  []*tablestore.FieldSchema{fieldSchema("name", tablestore.FieldType_KEYWORD), fieldSchema("age", tablestore.FieldType_LONG)},
+			want:    []change{},
+		},
+		{
+			name:    "added removed and retyped",
+			current: []*tablestore.FieldSchema{fieldSchema("age", tablestore.FieldType_LONG), fieldSchema("old", tablestore.FieldType_KEYWORD)},
+			target:  []*tablestore.FieldSchema{fieldSchema("age", tablestore.FieldType_DOUBLE), fieldSchema("new", tablestore.FieldType_KEYWORD)},
+			want: []change{
+				{"age", FieldRetyped, nil},
+				{"new", FieldAdded, nil},
+				{"old", FieldRemoved, nil},
+			},
+		},
+		{
+			name:    "server default store is true",
+			current: []*tablestore.FieldSchema{fieldSchema("name", tablestore.FieldType_KEYWORD)},
+			target:  []*tablestore.FieldSchema{withStore(fieldSchema("name", tablestore.FieldType_KEYWORD), true)},
+			want:    []change{},
+		},
+		{
+			name:    "store changed",
+			current: []*tablestore.FieldSchema{withStore(fieldSchema("name", tablestore.FieldType_KEYWORD), true)},
+			target:  []*tablestore.FieldSchema{withStore(fieldSchema("name", tablestore.FieldType_KEYWORD), false)},
+			want:    []change{{"name", FieldModified, []string{"store"}}},
+		},
+		{
+			name:    "default analyzer is single word",
+			current: []*tablestore.FieldSchema{fieldSchema("title", tablestore.FieldType_TEXT)},
+			target:  []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_SingleWord, nil)},
+			want:    []change{},
+		},
+		{
+			name:    "default fuzzy parameter",
+			current: []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_Fuzzy, nil)},
+			target: []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_Fuzzy,
+				tablestore.FuzzyAnalyzerParameter{MinChars: defaultFuzzyMinChars, MaxChars: defaultFuzzyMaxChars})},
+			want: []change{},
+		},
+		{
+			name:    "analyzer changed",
+			current: []*tablestore.FieldSchema{fieldSchema("title", tablestore.FieldType_TEXT)},
+			target:  []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_MaxWord, nil)},
+			want:    []change{{"title", FieldModified, []string{"analyzer"}}},
+		},
+		{
+			name:    "analyzer parameter changed",
+			current: []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_Split, nil)},
+			target: []*tablestore.FieldSchema{withAnalyzer(fieldSchema("title", tablestore.FieldType_TEXT), tablestore.Analyzer_Split,
+				tablestore.SplitAnalyzerParameter{Delimiter: proto.String(",")})},
+			want: []change{{"title", FieldModified, []string{"analyzerParameter"}}},
+		},
+		{
+			name:    "nested field",
+			current: []*tablestore.FieldSchema{nested("tags", fieldSchema("name", tablestore.FieldType_KEYWORD))},
+			target:  []*tablestore.FieldSchema{nested("tags", fieldSchema("name", tablestore.FieldType_KEYWORD), fieldSchema("score", tablestore.FieldType_LONG))},
+			want:    []change{{"tags.score", FieldAdded, nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffIndexSchema(&tablestore.IndexSchema{FieldSchemas: tt.current}, &tablestore.IndexSchema{FieldSchemas: tt.target})
+			got := []change{}
+			for _, c := range diff.Fields {
+				attributes := c.Attributes
+				if len(attributes) == 0 {
+					attributes = nil
+				}
+				got = append(got, change{c.Field, c.Type, attributes})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffIndexSchema() = %+v, want %+v", got, tt.want)
+			}
+			if diff.HasChanges() != (len(tt.want) > 0) {
+				t.Errorf("HasChanges() = %v", diff.HasChanges())
+			}
+		})
+	}
+}
+
+func TestDiffIndexSchemaSettings(t *testing.T) {
+	schema := func(routing []string, sorters ...search.Sorter) *tablestore.IndexSchema {
+		s := &tablestore.IndexSchema{}
+		if routing != nil {
+			s.IndexSetting = &tablestore.IndexSetting{RoutingFields: routing}
+		}
+		if len(sorters) > 0 {
+			s.IndexSort = &search.Sort{Sorters: sorters}
+		}
+		return s
+	}
+	desc := search.SortOrder_DESC
+	tests := []struct {
+		name            string
+		current, target *tablestore.IndexSchema
+		routingChanged  bool
+		sortChanged     bool
+	}{
+		{"defaults", schema(nil), schema(nil), false, false},
+		{"empty routing is default", schema([]string{}), schema(nil), false, false},
+		{"primary key sort is default", schema(nil, search.NewPrimaryKeySort()), schema(nil), false, false},
+		{"routing changed", schema(nil), schema([]string{"tenant"}), true, false},
+		{"sort changed", schema(nil), schema(nil, &search.FieldSort{FieldName: "ts", Order: &desc}), false, true},
+		{"current missing", nil, schema(nil), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffIndexSchema(tt.current, tt.target)
+			if diff.RoutingFieldsChanged != tt.routingChanged || diff.IndexSortChanged != tt.sortChanged {
+				t.Errorf("routing, sort changed = %v, %v, want %v, %v", diff.RoutingFieldsChanged, diff.IndexSortChanged, tt.routingChanged, tt.sortChanged)
+			}
+		})
+	}
+}
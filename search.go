@@ -19,7 +19,7 @@ func (db *DB) Count(num *int) error {
 func (db *DB) First(obj interface{}) error {
 	db.limit = 1
 
-	resp, err := db.search(GetTableName(obj), true)
+	resp, err := db.search(obj, true)
 	if err != nil {
 		return err
 	}
@@ -30,6 +30,115 @@ func (db *DB) First(obj interface{}) error {
 	return nil
 }
 
+//根据主键直接读取主表，不经过多元索引，因此没有同步延迟
+//通过UseIndex指定了二级索引时，先按索引列读取索引表，再回查主表
+func (db *DB) Get(obj interface{}) error {
+	if indexName := db.secondaryIndex; indexName != "" {
+		db.secondaryIndex = ""
+		return db.getByIndex(obj, indexName)
+	}
+	return db.get(obj, nil)
+}
+
+//transactionID不为空时在局部事务中读取，可以读到事务内未提交的写入
+func (db *DB) get(obj interface{}, transactionID *string) error {
+	pk, err := GetPrimaryKey(obj)
+	if err != nil {
+		return err
+	}
+
+	criteria := &tablestore.SingleRowQueryCriteria{
+		TableName:     db.tableName(obj),
+		PrimaryKey:    pk,
+		MaxVersion:    1,
+		TransactionId: transactionID,
+	}
+
+	resp, err := db.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return err
+	}
+
+	//行不存在时返回的主键为空
+	if len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return NotResultFound
+	}
+
+	return LoadData(obj, &tablestore.Row{PrimaryKey: &resp.PrimaryKey, Columns: resp.Columns})
+}
+
+//BatchGetRow单次请求的最大行数
+const batchGetRowLimit = 100
+
+//根据多个主键批量读取主表，obj为slice指针，不存在的ID会被忽略
+//复合主键时每个id为按主键顺序排列的[]interface{}
+func (db *DB) FindByIDs(obj interface{}, ids ...interface{}) error {
+	typ := reflect.TypeOf(obj)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if typ.Kind() != reflect.Slice {
+			return fmt.Errorf("not a slice")
+		}
+	} else {
+		return fmt.Errorf("not a pointer")
+	}
+
+	result := reflect.MakeSlice(reflect.SliceOf(typ.Elem()), 0, len(ids))
+	model := reflect.New(typ.Elem()).Interface()
+	tableName := db.tableName(model)
+
+	//超过单次请求的最大行数时分批读取
+	for start := 0; start < len(ids); start += batchGetRowLimit {
+		end := start + batchGetRowLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		criteria := &tablestore.MultiRowQueryCriteria{
+			TableName:  tableName,
+			MaxVersion: 1,
+		}
+		for _, id := range ids[start:end] {
+			values, ok := id.([]interface{})
+			if !ok {
+				values = []interface{}{id}
+			}
+			pk, err := buildPrimaryKey(model, values...)
+			if err != nil {
+				return err
+			}
+			criteria.AddRow(pk)
+		}
+
+		batchGetReq := &tablestore.BatchGetRowRequest{}
+		batchGetReq.MultiRowQueryCriteria = append(batchGetReq.MultiRowQueryCriteria, criteria)
+		resp, err := db.client.BatchGetRow(batchGetReq)
+		if err != nil {
+			return err
+		}
+
+		for _, rowResult := range resp.TableToRowsResult[tableName] {
+			if !rowResult.IsSucceed {
+				return fmt.Errorf("get row error, error: %s", rowResult.Error)
+			}
+			//行不存在时返回的主键为空
+			if len(rowResult.PrimaryKey.PrimaryKeys) == 0 {
+				continue
+			}
+
+			item := reflect.New(typ.Elem()).Interface()
+			row := &tablestore.Row{PrimaryKey: &rowResult.PrimaryKey, Columns: rowResult.Columns}
+			if err := LoadData(item, row); err != nil {
+				return err
+			}
+			result = reflect.Append(result, reflect.ValueOf(item).Elem())
+		}
+	}
+
+	reflect.ValueOf(obj).Elem().Set(result)
+	return nil
+}
+
 func (db *DB) Find(obj interface{}) error {
 	typ := reflect.TypeOf(obj)
 	if typ.Kind() == reflect.Ptr {
@@ -44,8 +153,7 @@ func (db *DB) Find(obj interface{}) error {
 	//根据传入类型动态创建一个空slice
 	result := reflect.MakeSlice(reflect.SliceOf(typ.Elem()), 0, 0)
 
-	tableName := GetTableName(reflect.New(typ.Elem()).Interface())
-	resp, err := db.search(tableName, true)
+	resp, err := db.search(reflect.New(typ.Elem()).Interface(), true)
 	if err != nil {
 		return err
 	}
@@ -71,7 +179,10 @@ func (db *DB) FindByToken(obj interface{}, token []byte) (nextToken []byte, err
 	return []byte(""), nil
 }
 
-func (db *DB) search(tableName string, getColumns bool) (*tablestore.SearchResponse, error) {
+func (db *DB) search(obj interface{}, getColumns bool) (*tablestore.SearchResponse, error) {
+	//重置请求条件为默认值，防止影响下次请求，出错提前返回时也需要重置
+	defer db.reset()
+
 	//前置检查，防止传参错误
 	if err := db.checkRequest(); err != nil {
 		return nil, err
@@ -79,7 +190,6 @@ func (db *DB) search(tableName string, getColumns bool) (*tablestore.SearchRespo
 
 	//构造searchQuery
 	searchQuery := search.NewSearchQuery()
-	searchQuery.SetQuery(db.query)
 	searchQuery.SetLimit(int32(db.limit))
 	searchQuery.SetOffset(int32(db.offset))
 	searchQuery.SetToken(db.token)
@@ -87,19 +197,32 @@ func (db *DB) search(tableName string, getColumns bool) (*tablestore.SearchRespo
 	//searchQuery.SetCollapse(true)
 	searchQuery.SetGetTotalCount(db.getTotalCount)
 
-	//通过obj提取表名，索引名默认为tableName_index
+	//通过obj提取表名和索引名，索引名默认为tableName_index，索引重建后使用别名指向的版本
+	indexName, err := db.activeIndexName(obj)
+	if err != nil {
+		return nil, err
+	}
 	searchRequest := &tablestore.SearchRequest{}
-	searchRequest.SetTableName(tableName)
-	searchRequest.SetIndexName(fmt.Sprintf("%s_index", tableName))
+	searchRequest.SetTableName(db.tableName(obj))
+	searchRequest.SetIndexName(indexName)
+	//查询条件固定了路由字段时只查询对应的分区
+	routingValues, err := getRoutingValues(obj, db.query)
+	if err != nil {
+		return nil, err
+	}
+	searchRequest.SetRoutingValues(routingValues)
+	//查询条件中的time.Time按字段的存储格式转换，转换的是副本，不修改调用方传入的查询条件
+	convertedQuery, err := convertQueryValues(obj, db.query)
+	if err != nil {
+		return nil, err
+	}
+	searchQuery.SetQuery(convertedQuery)
 	searchRequest.SetSearchQuery(searchQuery)
 	//是否返回所有列，delete时只需要返回主键即可
 	searchRequest.SetColumnsToGet(&tablestore.ColumnsToGet{
 		ReturnAll: getColumns,
 	})
 
-	//重置请求条件为默认值，防止影响下次请求
-	db.reset()
-
 	//发出请求
 	resp, err := db.client.Search(searchRequest)
 	if err != nil {
@@ -143,4 +266,5 @@ func (db *DB) reset() {
 	db.getTotalCount = false
 	db.sorters = nil
 	db.token = nil
+	db.secondaryIndex = ""
 }
@@ -0,0 +1,26 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/diemus/tableorm/query"
+	"testing"
+	"time"
+)
+
+//请求出错提前返回时也要重置查询条件，否则会影响下次请求
+func TestSearchResetsOnError(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	db.indexAliases.set("badtimeformatevent", "badtimeformatevent_index")
+
+	db.Query(query.TermQuery("at", time.Now())).Offset(10).SortByField("at", true)
+	if err := db.First(&badTimeFormatEvent{}); err == nil {
+		t.Fatal("First() expected error for unknown time format")
+	}
+
+	if db.limit != -1 || db.offset != -1 || db.getTotalCount || db.sorters != nil || db.token != nil {
+		t.Errorf("state not reset: limit %d offset %d total %v sorters %v token %v", db.limit, db.offset, db.getTotalCount, db.sorters, db.token)
+	}
+	if _, ok := db.query.(*search.MatchAllQuery); !ok {
+		t.Errorf("query = %T, want *search.MatchAllQuery", db.query)
+	}
+}
@@ -4,30 +4,56 @@ import (
 	"fmt"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 	"log"
-	"reflect"
+	"time"
 )
 
-//创建表，表名为结构体小写，主键约定为 _id string
+//创建表，表名由命名规则决定，默认为结构体小写
+//主键约定为 _id string，也可以通过pk tag指定复合主键，主键类型根据字段类型推断
 func (db *DB) CreateTable(obj interface{}) error {
+	//主键无法修改，创建前检查模型，例如自增列不能是分区键且必须为int64
+	if err := CheckModel(obj); err != nil {
+		return err
+	}
+
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return err
+	}
+
 	tableMeta := new(tablestore.TableMeta)
-	tableMeta.TableName = GetTableName(obj)
-	tableMeta.AddPrimaryKeyColumn("_id", tablestore.PrimaryKeyType_STRING)
+	tableMeta.TableName = db.tableName(obj)
+	for _, pkField := range pkFields {
+		pkType, err := getPrimaryKeyType(obj, pkField)
+		if err != nil {
+			return err
+		}
+		if pkField.Generator != nil && isAutoIncrement(pkField.Generator) {
+			tableMeta.AddPrimaryKeyColumnOption(pkField.Column, pkType, tablestore.AUTO_INCREMENT)
+		} else {
+			tableMeta.AddPrimaryKeyColumn(pkField.Column, pkType)
+		}
+	}
+
+	options, err := GetTableOptions(obj)
+	if err != nil {
+		return err
+	}
 
 	tableOption := new(tablestore.TableOption)
-	tableOption.TimeToAlive = -1
-	tableOption.MaxVersion = 1
+	tableOption.TimeToAlive = options.TimeToAlive
+	tableOption.MaxVersion = options.MaxVersion
 
-	//预留吞吐量按小时收费，因此设为0，不预留
+	//预留吞吐量按小时收费，默认为0，不预留
 	reservedThroughput := new(tablestore.ReservedThroughput)
-	reservedThroughput.Readcap = 0
-	reservedThroughput.Writecap = 0
+	reservedThroughput.Readcap = options.ReservedRead
+	reservedThroughput.Writecap = options.ReservedWrite
 
 	createTableRequest := new(tablestore.CreateTableRequest)
 	createTableRequest.TableMeta = tableMeta
 	createTableRequest.TableOption = tableOption
 	createTableRequest.ReservedThroughput = reservedThroughput
 
-	_, err := db.client.CreateTable(createTableRequest)
+	_, err = db.client.CreateTable(createTableRequest)
 	if err != nil {
 		return err
 	}
@@ -38,7 +64,7 @@ func (db *DB) CreateTable(obj interface{}) error {
 //删除表
 func (db *DB) DeleteTable(obj interface{}) error {
 	deleteReq := new(tablestore.DeleteTableRequest)
-	deleteReq.TableName = GetTableName(obj)
+	deleteReq.TableName = db.tableName(obj)
 	_, err := db.client.DeleteTable(deleteReq)
 	if err != nil {
 		return err
@@ -48,20 +74,26 @@ func (db *DB) DeleteTable(obj interface{}) error {
 }
 
 //根据tag创建索引，默认所有字段都创建对应类型的索引，可以通过index tag覆盖默认
+//索引重建过时创建的是别名指向的当前版本
 func (db *DB) CreateIndex(obj interface{}) error {
-	request := &tablestore.CreateSearchIndexRequest{}
-	tableName := GetTableName(obj)
-	schemas, err := CreateIndexSchema(obj)
+	indexName, err := db.activeIndexName(obj)
 	if err != nil {
 		return err
 	}
+	return db.createIndex(obj, indexName)
+}
 
-	request.TableName = tableName
-	request.IndexName = fmt.Sprintf("%s_index", tableName)
-	request.IndexSchema = &tablestore.IndexSchema{
-		FieldSchemas: schemas,
+func (db *DB) createIndex(obj interface{}, indexName string) error {
+	request := &tablestore.CreateSearchIndexRequest{}
+	indexSchema, err := CreateIndexSchemaWithOptions(obj)
+	if err != nil {
+		return err
 	}
 
+	request.TableName = db.tableName(obj)
+	request.IndexName = indexName
+	request.IndexSchema = indexSchema
+
 	_, err = db.client.CreateSearchIndex(request)
 	if err != nil {
 		return err
@@ -69,11 +101,19 @@ func (db *DB) CreateIndex(obj interface{}) error {
 	return nil
 }
 
+//删除别名指向的当前索引
 func (db *DB) DeleteIndex(obj interface{}) error {
+	indexName, err := db.activeIndexName(obj)
+	if err != nil {
+		return err
+	}
+	return db.deleteIndex(obj, indexName)
+}
+
+func (db *DB) deleteIndex(obj interface{}, indexName string) error {
 	request := &tablestore.DeleteSearchIndexRequest{}
-	tableName := GetTableName(obj)
-	request.TableName = tableName
-	request.IndexName = fmt.Sprintf("%s_index", tableName)
+	request.TableName = db.tableName(obj)
+	request.IndexName = indexName
 	_, err := db.client.DeleteSearchIndex(request)
 	if err != nil {
 		return err
@@ -81,6 +121,128 @@ func (db *DB) DeleteIndex(obj interface{}) error {
 	return nil
 }
 
+//对比表级配置，有变化时通过UpdateTable修改，changed表示是否有修改
+func (db *DB) UpdateTableOptions(obj interface{}) (changed bool, err error) {
+	options, err := GetTableOptions(obj)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := db.getCurrentTableOptions(obj)
+	if err != nil {
+		return false, err
+	}
+
+	request := &tablestore.UpdateTableRequest{TableName: db.tableName(obj)}
+	if current.TimeToAlive != options.TimeToAlive || current.MaxVersion != options.MaxVersion {
+		request.TableOption = &tablestore.TableOption{
+			TimeToAlive: options.TimeToAlive,
+			MaxVersion:  options.MaxVersion,
+		}
+	}
+	if current.ReservedRead != options.ReservedRead || current.ReservedWrite != options.ReservedWrite {
+		request.ReservedThroughput = &tablestore.ReservedThroughput{
+			Readcap:  options.ReservedRead,
+			Writecap: options.ReservedWrite,
+		}
+	}
+
+	//只修改有变化的部分
+	if request.TableOption == nil && request.ReservedThroughput == nil {
+		return false, nil
+	}
+
+	_, err = db.client.UpdateTable(request)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//读取已有表的表级配置
+func (db *DB) getCurrentTableOptions(obj interface{}) (*TableOptions, error) {
+	resp, err := db.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: db.tableName(obj)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TableOptions{
+		TimeToAlive:   resp.TableOption.TimeToAlive,
+		MaxVersion:    resp.TableOption.MaxVersion,
+		ReservedRead:  resp.ReservedThroughput.Readcap,
+		ReservedWrite: resp.ReservedThroughput.Writecap,
+	}, nil
+}
+
+//等待表可以读写的轮询间隔和超时时间
+const (
+	tableReadyPollInterval = time.Second
+	tableReadyTimeout      = time.Minute
+)
+
+//表不存在时创建，用于内部使用的表
+//多个实例可能同时创建，表已存在视为成功，返回前等待表可以读写
+func (db *DB) ensureTable(obj interface{}) error {
+	tableExist, err := db.isTableExist(obj)
+	if err != nil {
+		return err
+	}
+	if tableExist {
+		return nil
+	}
+
+	log.Printf("table not exist, create table %s", db.tableName(obj))
+	if err := db.CreateTable(obj); err != nil && !isObjectAlreadyExist(err) {
+		return err
+	}
+	return db.waitTableReady(obj)
+}
+
+//表创建后需要一段时间才能读写，通过读取一行判断表是否可用
+func (db *DB) waitTableReady(obj interface{}) error {
+	tableName := db.tableName(obj)
+	deadline := time.Now().Add(tableReadyTimeout)
+	for {
+		err := db.probeTable(tableName)
+		if err == nil {
+			return nil
+		}
+		if !isTableNotReady(err) && !isObjectNotExist(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait table %s ready timeout: %w", tableName, err)
+		}
+		time.Sleep(tableReadyPollInterval)
+	}
+}
+
+//按主键的全部范围读取一行，表不可用时返回错误
+func (db *DB) probeTable(tableName string) error {
+	resp, err := db.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: tableName})
+	if err != nil {
+		return err
+	}
+
+	startPK := new(tablestore.PrimaryKey)
+	endPK := new(tablestore.PrimaryKey)
+	for _, schema := range resp.TableMeta.SchemaEntry {
+		startPK.AddPrimaryKeyColumnWithMinValue(*schema.Name)
+		endPK.AddPrimaryKeyColumnWithMaxValue(*schema.Name)
+	}
+	_, err = db.client.GetRange(&tablestore.GetRangeRequest{
+		RangeRowQueryCriteria: &tablestore.RangeRowQueryCriteria{
+			TableName:       tableName,
+			StartPrimaryKey: startPK,
+			EndPrimaryKey:   endPK,
+			Direction:       tablestore.FORWARD,
+			MaxVersion:      1,
+			Limit:           1,
+		},
+	})
+	return err
+}
+
 //查询相关的表是否创建
 func (db *DB) isTableExist(obj interface{}) (bool, error) {
 	tables, err := db.client.ListTable()
@@ -89,7 +251,7 @@ func (db *DB) isTableExist(obj interface{}) (bool, error) {
 	}
 
 	for _, table := range tables.TableNames {
-		if table == GetTableName(obj) {
+		if table == db.tableName(obj) {
 			return true, nil
 		}
 	}
@@ -98,17 +260,16 @@ func (db *DB) isTableExist(obj interface{}) (bool, error) {
 }
 
 //查询相关的表的索引是否创建
-func (db *DB) isIndexExist(obj interface{}) (bool, error) {
-	tableName := GetTableName(obj)
+func (db *DB) isIndexExist(obj interface{}, indexName string) (bool, error) {
 	request := &tablestore.ListSearchIndexRequest{}
-	request.TableName = tableName
+	request.TableName = db.tableName(obj)
 	resp, err := db.client.ListSearchIndex(request)
 	if err != nil {
 		return false, err
 	}
 
 	for _, index := range resp.IndexInfo {
-		if index.IndexName == fmt.Sprintf("%s_index", tableName) {
+		if index.IndexName == indexName {
 			return true, nil
 		}
 	}
@@ -116,45 +277,84 @@ func (db *DB) isIndexExist(obj interface{}) (bool, error) {
 	return false, nil
 }
 
-//对比schema是否变更
-func (db *DB) isIndexSchemaChange(obj interface{}) (bool, error) {
-	tableName := GetTableName(obj)
-	request := &tablestore.DescribeSearchIndexRequest{}
-	request.TableName = tableName
-	request.IndexName = fmt.Sprintf("%s_index", tableName)
-	resp, err := db.client.DescribeSearchIndex(request)
+//对比schema是否变更，包括字段、路由字段和预排序
+func (db *DB) isIndexSchemaChange(obj interface{}, indexName string) (bool, error) {
+	diff, err := db.indexSchemaDiff(obj, indexName)
 	if err != nil {
 		return false, err
 	}
 
-	currentSchema := resp.Schema.FieldSchemas
-	targetSchema, err := CreateIndexSchema(obj)
+	for _, change := range diff.Fields {
+		log.Printf("index %s field %s %s %v", indexName, change.Field, change.Type, change.Attributes)
+	}
+	return diff.HasChanges(), nil
+}
+
+//读取已有索引的schema
+func (db *DB) getIndexSchema(obj interface{}, indexName string) (*tablestore.IndexSchema, error) {
+	request := &tablestore.DescribeSearchIndexRequest{}
+	request.TableName = db.tableName(obj)
+	request.IndexName = indexName
+	resp, err := db.client.DescribeSearchIndex(request)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	return resp.Schema, nil
+}
 
-	return !reflect.DeepEqual(currentSchema, targetSchema), nil
+//表的同步结果
+type TableAction string
+
+const (
+	TableCreated  TableAction = "created"
+	TableExisting TableAction = "existing"
+)
+
+//单个模型的同步结果，Err不为空时后续步骤没有执行
+type MigrateResult struct {
+	Table          string
+	TableAction    TableAction
+	OptionsUpdated bool
+	Index          string
+	IndexAction    IndexAction
+	//新创建的全局二级索引
+	SecondaryIndexes []string
+	Duration         time.Duration
+	Err              error
 }
 
 //自动根据结构体创建或者更新表和索引
-func (db *DB) AutoMigrate(models ...interface{}) {
+//某个模型失败时继续同步其余模型，所有失败合并为MigrateError返回，结果与models一一对应
+func (db *DB) AutoMigrate(models ...interface{}) ([]*MigrateResult, error) {
+	results := []*MigrateResult{}
+	migrateErr := &MigrateError{}
 	for _, obj := range models {
-		err := db.syncModel(obj)
-		if err != nil {
-			return
+		start := time.Now()
+		result := &MigrateResult{Table: db.tableName(obj)}
+		result.Err = db.syncModel(obj, result)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+
+		if result.Err != nil {
+			migrateErr.Errors = append(migrateErr.Errors, fmt.Errorf("migrate table %s error: %w", result.Table, result.Err))
 		}
 	}
+
+	if len(migrateErr.Errors) > 0 {
+		return results, migrateErr
+	}
+	return results, nil
 }
 
-//同步model，如果不存在则创建，存在则检查索引是否有变动，有变动删除重建
-func (db *DB) syncModel(obj interface{}) error {
+//同步model，如果不存在则创建，存在则检查索引是否有变动，有变动创建新版本的索引并切换
+func (db *DB) syncModel(obj interface{}, result *MigrateResult) error {
 	//先检查模型是否定义正确
 	err := CheckModel(obj)
 	if err != nil {
 		return err
 	}
 
-	tableName := GetTableName(obj)
+	tableName := db.tableName(obj)
 	log.Printf("start sync model %s", tableName)
 	defer log.Printf("end sync model %s", tableName)
 
@@ -164,7 +364,7 @@ func (db *DB) syncModel(obj interface{}) error {
 		return err
 	}
 
-	//表不存在直接创建表，已经存在就不作修改了
+	//表不存在直接创建表，已经存在则同步表级配置，主键无法修改
 	if !tableExist {
 		log.Printf("table not exist, create table %s", tableName)
 		err := db.CreateTable(obj)
@@ -172,50 +372,96 @@ func (db *DB) syncModel(obj interface{}) error {
 			log.Printf("create table %s error %s", tableName, err)
 			return err
 		}
+		result.TableAction = TableCreated
 	} else {
 		log.Printf("table %s exist", tableName)
+		result.TableAction = TableExisting
+
+		changed, err := db.UpdateTableOptions(obj)
+		if err != nil {
+			log.Printf("update table %s options error %s", tableName, err)
+			return err
+		}
+		if changed {
+			log.Printf("table %s options changed, update table", tableName)
+		}
+		result.OptionsUpdated = changed
 	}
 
-	//检查索引是否已经创建
-	indexExist, err := db.isIndexExist(obj)
+	//全局二级索引只创建缺少的，已有索引无法修改
+	result.SecondaryIndexes, err = db.syncSecondaryIndexes(obj)
+	if err != nil {
+		log.Printf("sync secondary indexes of table %s error %s", tableName, err)
+		return err
+	}
+
+	//索引可能已经重建过，检查别名指向的当前版本
+	indexName, err := db.activeIndexName(obj)
 	if err != nil {
-		log.Printf("check index %s_index error %s", tableName, err)
+		log.Printf("get active index of table %s error %s", tableName, err)
 		return err
 	}
+	result.Index = indexName
 
-	//索引与表不一样，在存在索引的情况下，直接删除旧的索引，创建新的，同步最新索引信息
-	//因为索引无法修改，只能删除重建
-	if indexExist {
-		log.Printf("index %s_index already exist", tableName)
+	//检查索引是否已经创建
+	indexExist, err := db.isIndexExist(obj, indexName)
+	if err != nil {
+		log.Printf("check index %s error %s", indexName, err)
+		return err
+	}
 
-		//对比索引schema，查看是否有变动
-		schemaChanged, err := db.isIndexSchemaChange(obj)
+	if !indexExist {
+		log.Printf("index %s not exist, create index %s", indexName, indexName)
+		err = db.createIndex(obj, indexName)
 		if err != nil {
-			log.Printf("check index %s_index schema error %s", tableName, err)
+			log.Printf("create index %s error %s", indexName, err)
 			return err
 		}
+		result.IndexAction = IndexCreate
 
-		//schema有变化，删除重建
-		if schemaChanged {
-			log.Printf("index %s_index schema changed, recreate index", tableName)
-			err = db.DeleteIndex(obj)
+		//新建的索引需要全量同步已有数据，同步完成前查询结果不完整
+		if db.migrateOptions.WaitIndexReady {
+			err = db.waitIndexReady(obj, indexName, 0)
 			if err != nil {
-				log.Printf("delete index %s_index error %s", tableName, err)
+				log.Printf("wait index %s ready error %s", indexName, err)
 				return err
 			}
-			log.Printf("delete index %s_index success", tableName)
-		} else {
-			log.Printf("index %s_index schema not changed", tableName)
-			return nil
 		}
-	} else {
-		log.Printf("index %s_index not exist", tableName)
+		return nil
+	}
+
+	log.Printf("index %s already exist", indexName)
+
+	//删除之前重建或DropPreviousIndex留下的、已经到期但后台没有删除的旧索引
+	if err := db.dropRetiredIndexesLocked(obj); err != nil {
+		log.Printf("drop retired indexes of table %s error %s", tableName, err)
+		return err
+	}
+
+	//对比索引schema，查看是否有变动
+	schemaChanged, err := db.isIndexSchemaChange(obj, indexName)
+	if err != nil {
+		log.Printf("check index %s schema error %s", indexName, err)
+		return err
+	}
+	if !schemaChanged {
+		log.Printf("index %s schema not changed", indexName)
+		result.IndexAction = IndexUnchanged
+		return nil
+	}
+
+	//索引无法修改，创建新版本的索引，同步完成后切换，切换前查询继续使用旧索引
+	log.Printf("index %s schema changed, migrate to new index", indexName)
+	err = db.migrateIndex(obj, indexName)
+	if err != nil {
+		log.Printf("migrate index %s error %s", indexName, err)
+		return err
 	}
+	result.IndexAction = IndexRebuild
 
-	log.Printf("create index %s_index", tableName)
-	err = db.CreateIndex(obj)
+	//重建后别名指向新版本
+	result.Index, err = db.activeIndexName(obj)
 	if err != nil {
-		log.Printf("create index %s_index error %s", tableName, err)
 		return err
 	}
 
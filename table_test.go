@@ -0,0 +1,37 @@
+package tableorm
+
+import (
+	"strings"
+	"testing"
+)
+
+type autoIncrementPartitionKey struct {
+	Seq    int64  `json:"seq" pk:"1" tableorm:"idGenerator:autoIncrement"`
+	Tenant string `json:"tenant" pk:"2"`
+}
+
+type autoIncrementStringKey struct {
+	Tenant string `json:"tenant" pk:"1"`
+	Seq    string `json:"seq" pk:"2" tableorm:"idGenerator:autoIncrement"`
+}
+
+func TestCreateTableChecksModel(t *testing.T) {
+	//检查失败时不会请求服务端，地址不需要可用
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	tests := []struct {
+		name string
+		obj  interface{}
+		want string
+	}{
+		{"auto increment partition key", &autoIncrementPartitionKey{}, "can not be partition key"},
+		{"auto increment string", &autoIncrementStringKey{}, "must be int64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.CreateTable(tt.obj)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CreateTable() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package tableorm
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//表级配置
+type TableOptions struct {
+	//数据生命周期，单位秒，-1表示永不过期，为0时按-1处理
+	TimeToAlive int
+	//最大版本数，为0时按1处理
+	MaxVersion int
+	//预留读写吞吐量，预留吞吐量按小时收费，默认为0，不预留
+	ReservedRead  int
+	ReservedWrite int
+}
+
+//模型可以实现该接口来指定表级配置，优先级高于tag
+type TableOptionsProvider interface {
+	TableOptions() TableOptions
+}
+
+//通过分区键字段上的tag指定表级配置，例如 tableorm:"ttl:86400;maxVersion:1;readCU:0;writeCU:0"
+var tagToTableOptionMap = map[string]func(options *TableOptions, value int){
+	"ttl":        func(options *TableOptions, value int) { options.TimeToAlive = value },
+	"maxVersion": func(options *TableOptions, value int) { options.MaxVersion = value },
+	"readCU":     func(options *TableOptions, value int) { options.ReservedRead = value },
+	"writeCU":    func(options *TableOptions, value int) { options.ReservedWrite = value },
+}
+
+//获取模型的表级配置，优先级为 模型方法 > tag > 默认值
+func GetTableOptions(obj interface{}) (*TableOptions, error) {
+	options := &TableOptions{
+		TimeToAlive: -1,
+		MaxVersion:  1,
+	}
+
+	if provider, ok := obj.(TableOptionsProvider); ok {
+		*options = provider.TableOptions()
+	} else {
+		settings, err := getModelTag(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range settings {
+			set, ok := tagToTableOptionMap[key]
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected table option %s %s", key, value)
+			}
+			set(options, n)
+		}
+	}
+
+	if options.TimeToAlive == 0 {
+		options.TimeToAlive = -1
+	}
+	if options.MaxVersion == 0 {
+		options.MaxVersion = 1
+	}
+	return options, nil
+}
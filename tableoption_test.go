@@ -0,0 +1,80 @@
+package tableorm
+
+import (
+	"testing"
+)
+
+type optionDefaultModel struct {
+	ID string `json:"_id"`
+}
+
+type optionTagModel struct {
+	ID string `json:"_id" tableorm:"ttl:86400;maxVersion:3;readCU:1;writeCU:2"`
+}
+
+type optionZeroTagModel struct {
+	ID string `json:"_id" tableorm:"ttl:0;maxVersion:0"`
+}
+
+type optionBadTagModel struct {
+	ID string `json:"_id" tableorm:"ttl:1d"`
+}
+
+type optionNoIDModel struct {
+	Name string `json:"name"`
+}
+
+//接口优先级高于tag，没有设置的值使用默认值
+type optionProviderModel struct {
+	ID string `json:"_id" tableorm:"ttl:86400"`
+}
+
+func (optionProviderModel) TableOptions() TableOptions {
+	return TableOptions{ReservedWrite: 5}
+}
+
+func TestGetTableOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+		want TableOptions
+	}{
+		{"default", &optionDefaultModel{}, TableOptions{TimeToAlive: -1, MaxVersion: 1}},
+		{"tag", &optionTagModel{}, TableOptions{TimeToAlive: 86400, MaxVersion: 3, ReservedRead: 1, ReservedWrite: 2}},
+		{"zero tag", &optionZeroTagModel{}, TableOptions{TimeToAlive: -1, MaxVersion: 1}},
+		{"provider", &optionProviderModel{}, TableOptions{TimeToAlive: -1, MaxVersion: 1, ReservedWrite: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetTableOptions(tt.obj)
+			if err != nil {
+				t.Fatalf("GetTableOptions() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("GetTableOptions() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTableOptionsError(t *testing.T) {
+	if _, err := GetTableOptions(&optionBadTagModel{}); err == nil {
+		t.Error("GetTableOptions() should reject non-integer option")
+	}
+	if _, err := GetTableOptions(&optionNoIDModel{}); err != IDFieldNotExist {
+		t.Errorf("GetTableOptions() error = %v, want %v", err, IDFieldNotExist)
+	}
+}
+
+func TestParseTableormTag(t *testing.T) {
+	got := parseTableormTag(" ttl:86400 ; maxVersion: 2;hashPrefix;;")
+	want := map[string]string{"ttl": "86400", "maxVersion": "2", "hashPrefix": ""}
+	if len(got) != len(want) {
+		t.Fatalf("parseTableormTag() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("parseTableormTag()[%s] = %q, want %q", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package tableorm
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/oleiade/reflections"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//time.Time字段的存储格式
+type TimeFormat string
+
+const (
+	TimeFormatSecond TimeFormat = "second"
+	TimeFormatMilli  TimeFormat = "milli"
+	TimeFormatMicro  TimeFormat = "micro"
+	//UTC时间，精度为秒，字典序与时间顺序一致，可以进行范围查询
+	TimeFormatRFC3339 TimeFormat = "rfc3339"
+)
+
+//没有在tag中指定格式时使用的默认格式，例如 tableorm:"timeFormat:rfc3339"
+var DefaultTimeFormat = TimeFormatMilli
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+)
+
+//是否为time.Time、*time.Time或sql.NullTime
+func isTimeType(typ reflect.Type) bool {
+	return typ == timeType || typ == nullTimeType || (typ.Kind() == reflect.Ptr && typ.Elem() == timeType)
+}
+
+//获取结构体字段的类型，obj可以是结构体或结构体指针
+func getFieldType(obj interface{}, field string) (reflect.Type, bool) {
+	typ := reflect.TypeOf(obj)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+	structField, ok := typ.FieldByName(field)
+	if !ok {
+		return nil, false
+	}
+	return structField.Type, true
+}
+
+//获取时间字段的存储格式，不是时间字段时ok为false
+func getTimeFormat(obj interface{}, field string) (format TimeFormat, ok bool, err error) {
+	typ, ok := getFieldType(obj, field)
+	if !ok || !isTimeType(typ) {
+		return "", false, nil
+	}
+
+	tag, _ := reflections.GetFieldTag(obj, field, "tableorm")
+	value, ok := parseTableormTag(tag)["timeFormat"]
+	if !ok || value == "" {
+		return DefaultTimeFormat, true, nil
+	}
+
+	format = TimeFormat(strings.ToLower(value))
+	switch format {
+	case TimeFormatSecond, TimeFormatMilli, TimeFormatMicro, TimeFormatRFC3339:
+		return format, true, nil
+	}
+	return "", true, fmt.Errorf("unexpected time format %s %s", field, value)
+}
+
+//时间戳存储为LONG，RFC3339存储为KEYWORD
+func (f TimeFormat) indexType() tablestore.FieldType {
+	if f == TimeFormatRFC3339 {
+		return tablestore.FieldType_KEYWORD
+	}
+	return tablestore.FieldType_LONG
+}
+
+//转换为列值，不使用UnixNano，避免1678年之前和2262年之后的时间溢出
+func (f TimeFormat) encode(t time.Time) interface{} {
+	switch f {
+	case TimeFormatSecond:
+		return t.Unix()
+	case TimeFormatMicro:
+		return t.Unix()*1e6 + int64(t.Nanosecond())/1e3
+	case TimeFormatRFC3339:
+		return t.UTC().Format(time.RFC3339)
+	default:
+		return t.Unix()*1e3 + int64(t.Nanosecond())/1e6
+	}
+}
+
+//从列值还原时间
+func (f TimeFormat) decode(field string, value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case int64:
+		switch f {
+		case TimeFormatSecond:
+			return time.Unix(v, 0), nil
+		case TimeFormatMicro:
+			return time.Unix(v/1e6, v%1e6*1e3), nil
+		case TimeFormatMilli:
+			return time.Unix(v/1e3, v%1e3*1e6), nil
+		}
+	case string:
+		if f == TimeFormatRFC3339 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("parse time field %s error: %w", field, err)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("field %s with time format %s can not load from %T", field, f, value)
+}
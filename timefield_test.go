@@ -0,0 +1,300 @@
+package tableorm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"testing"
+	"time"
+)
+
+type timeEvent struct {
+	ID        string     `json:"_id"`
+	At        time.Time  `json:"at"`
+	SentAt    time.Time  `json:"sentAt" tableorm:"timeFormat:second"`
+	Day       time.Time  `json:"day" tableorm:"timeFormat:RFC3339"`
+	ShippedAt *time.Time `json:"shippedAt" tableorm:"timeFormat:micro"`
+	Count     int64      `json:"count"`
+}
+
+type badTimeFormatEvent struct {
+	At time.Time `json:"at" tableorm:"timeFormat:nano"`
+}
+
+func TestGetTimeFormat(t *testing.T) {
+	tests := []struct {
+		field  string
+		want   TimeFormat
+		isTime bool
+	}{
+		{"At", DefaultTimeFormat, true},
+		{"SentAt", TimeFormatSecond, true},
+		{"Day", TimeFormatRFC3339, true},
+		{"ShippedAt", TimeFormatMicro, true},
+		{"Count", "", false},
+		{"Missing", "", false},
+	}
+	for _, tt := range tests {
+		format, isTime, err := getTimeFormat(&timeEvent{}, tt.field)
+		if err != nil {
+			t.Fatalf("%s: getTimeFormat() error = %v", tt.field, err)
+		}
+		if format != tt.want || isTime != tt.isTime {
+			t.Errorf("%s: getTimeFormat() = %q, %v, want %q, %v", tt.field, format, isTime, tt.want, tt.isTime)
+		}
+	}
+
+	if _, _, err := getTimeFormat(&badTimeFormatEvent{}, "At"); err == nil {
+		t.Error("unknown time format should return error")
+	}
+}
+
+func TestTimeFormatIndexType(t *testing.T) {
+	if got := TimeFormatRFC3339.indexType(); got != tablestore.FieldType_KEYWORD {
+		t.Errorf("rfc3339 index type = %v, want KEYWORD", got)
+	}
+	for _, format := range []TimeFormat{TimeFormatSecond, TimeFormatMilli, TimeFormatMicro} {
+		if got := format.indexType(); got != tablestore.FieldType_LONG {
+			t.Errorf("%s index type = %v, want LONG", format, got)
+		}
+	}
+}
+
+func TestTimeFieldColumnValue(t *testing.T) {
+	at := time.Date(2020, 9, 13, 12, 26, 40, 123456789, time.UTC)
+	obj := &timeEvent{At: at, SentAt: at, Day: at, ShippedAt: &at, Count: 3}
+
+	want := map[string]interface{}{
+		"At":        int64(1600000000123),
+		"SentAt":    int64(1600000000),
+		"Day":       "2020-09-13T12:26:40Z",
+		"ShippedAt": int64(1600000000123456),
+		"Count":     int64(3),
+	}
+	loaded := &timeEvent{}
+	for field, wantValue := range want {
+		value, ok, err := getColumnValue(obj, field)
+		if err != nil || !ok {
+			t.Fatalf("%s: getColumnValue() = %v, %v", field, ok, err)
+		}
+		if value != wantValue {
+			t.Errorf("%s: getColumnValue() = %v, want %v", field, value, wantValue)
+		}
+		if err := setFieldValue(loaded, field, value); err != nil {
+			t.Fatalf("%s: setFieldValue() error = %v", field, err)
+		}
+	}
+
+	if !loaded.At.Equal(at.Truncate(time.Millisecond)) {
+		t.Errorf("At = %v", loaded.At)
+	}
+	if !loaded.SentAt.Equal(at.Truncate(time.Second)) {
+		t.Errorf("SentAt = %v", loaded.SentAt)
+	}
+	if !loaded.Day.Equal(at.Truncate(time.Second)) {
+		t.Errorf("Day = %v", loaded.Day)
+	}
+	if loaded.ShippedAt == nil || !loaded.ShippedAt.Equal(at.Truncate(time.Microsecond)) {
+		t.Errorf("ShippedAt = %v", loaded.ShippedAt)
+	}
+	if loaded.Count != 3 {
+		t.Errorf("Count = %v", loaded.Count)
+	}
+}
+
+func TestTimeFieldNilPointer(t *testing.T) {
+	_, ok, err := getColumnValue(&timeEvent{}, "ShippedAt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("nil time pointer should not be written")
+	}
+}
+
+func TestConvertQueryValues(t *testing.T) {
+	at := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	query := &search.BoolQuery{
+		MustQueries: []search.Query{&search.RangeQuery{FieldName: "sentAt", From: at, To: at.Add(time.Hour)}},
+		FilterQueries: []search.Query{&search.BoolQuery{ShouldQueries: []search.Query{
+			&search.TermQuery{FieldName: "day", Term: at},
+			&search.TermsQuery{FieldName: "unknown", Terms: []interface{}{at, "x"}},
+		}}},
+	}
+
+	converted, err := convertQueryValues(&timeEvent{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	convertedBool := converted.(*search.BoolQuery)
+	rangeQuery := convertedBool.MustQueries[0].(*search.RangeQuery)
+	if rangeQuery.From != int64(1600000000) || rangeQuery.To != int64(1600003600) {
+		t.Errorf("range = %v, %v", rangeQuery.From, rangeQuery.To)
+	}
+	should := convertedBool.FilterQueries[0].(*search.BoolQuery).ShouldQueries
+	if term := should[0].(*search.TermQuery).Term; term != "2020-09-13T12:26:40Z" {
+		t.Errorf("term = %v", term)
+	}
+	if terms := should[1].(*search.TermsQuery).Terms; terms[0] != DefaultTimeFormat.encode(at) || terms[1] != "x" {
+		t.Errorf("terms = %v", terms)
+	}
+}
+
+//转换的是副本，传入的查询条件保持不变，可以再次用于查询
+func TestConvertQueryValuesKeepsOriginal(t *testing.T) {
+	at := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	rangeQuery := &search.RangeQuery{FieldName: "sentAt", From: at}
+	termsQuery := &search.TermsQuery{FieldName: "day", Terms: []interface{}{at}}
+	inner := &search.BoolQuery{ShouldQueries: []search.Query{termsQuery}}
+	query := &search.BoolQuery{MustQueries: []search.Query{rangeQuery, inner}}
+
+	for i := 0; i < 2; i++ {
+		converted, err := convertQueryValues(&timeEvent{}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from := converted.(*search.BoolQuery).MustQueries[0].(*search.RangeQuery).From; from != int64(1600000000) {
+			t.Errorf("round %d: range from = %v", i, from)
+		}
+	}
+
+	if rangeQuery.From != at || termsQuery.Terms[0] != at {
+		t.Errorf("original query changed: %v %v", rangeQuery.From, termsQuery.Terms)
+	}
+	if query.MustQueries[0] != rangeQuery || query.MustQueries[1] != inner || inner.ShouldQueries[0] != termsQuery {
+		t.Error("original bool query changed")
+	}
+}
+
+func TestAutoTimeValue(t *testing.T) {
+	type post struct {
+		CreatedAt time.Time
+		UpdatedAt *time.Time
+		DeletedAt int64
+	}
+	tests := []struct {
+		field string
+		check func(interface{}) bool
+	}{
+		{"CreatedAt", func(v interface{}) bool { _, ok := v.(time.Time); return ok }},
+		{"UpdatedAt", func(v interface{}) bool { _, ok := v.(*time.Time); return ok }},
+		{"DeletedAt", func(v interface{}) bool { _, ok := v.(int64); return ok }},
+	}
+	for _, tt := range tests {
+		value, err := autoTimeValue(&post{}, tt.field, TimestampMilli)
+		if err != nil {
+			t.Fatalf("%s: autoTimeValue() error = %v", tt.field, err)
+		}
+		if !tt.check(value) {
+			t.Errorf("%s: autoTimeValue() = %T", tt.field, value)
+		}
+	}
+}
+
+func TestTimeFormatEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format TimeFormat
+		time   time.Time
+		want   interface{}
+	}{
+		{"second", TimeFormatSecond, time.Unix(1600000000, 999999999), int64(1600000000)},
+		{"milli", TimeFormatMilli, time.Unix(1600000000, 123456789), int64(1600000000123)},
+		{"micro", TimeFormatMicro, time.Unix(1600000000, 123456789), int64(1600000000123456)},
+		{"milli before epoch", TimeFormatMilli, time.Unix(-1, 999000000), int64(-1)},
+		{"micro before epoch", TimeFormatMicro, time.Unix(-1, 999999000), int64(-1)},
+		{"milli before 1678", TimeFormatMilli, time.Date(1500, 1, 1, 0, 0, 0, 0, time.UTC), int64(-14831769600000)},
+		{"milli after 2262", TimeFormatMilli, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), int64(32503680000000)},
+		{"micro zero time", TimeFormatMicro, time.Time{}, int64(-62135596800000000)},
+		{"rfc3339", TimeFormatRFC3339, time.Date(2020, 9, 13, 20, 26, 40, 0, time.FixedZone("CST", 8*3600)), "2020-09-13T12:26:40Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.encode(tt.time); got != tt.want {
+				t.Errorf("encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeFormatRoundTrip(t *testing.T) {
+	times := []time.Time{
+		time.Time{},
+		time.Date(1500, 6, 1, 12, 30, 0, 123456000, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999000, time.UTC),
+		time.Unix(0, 0),
+		time.Date(2020, 9, 13, 12, 26, 40, 123456000, time.UTC),
+		time.Date(3000, 1, 1, 0, 0, 0, 1000, time.UTC),
+	}
+	formats := []struct {
+		format    TimeFormat
+		precision time.Duration
+	}{
+		{TimeFormatSecond, time.Second},
+		{TimeFormatMilli, time.Millisecond},
+		{TimeFormatMicro, time.Microsecond},
+		{TimeFormatRFC3339, time.Second},
+	}
+	for _, f := range formats {
+		for _, want := range times {
+			t.Run(string(f.format)+"/"+want.Format(time.RFC3339Nano), func(t *testing.T) {
+				got, err := f.format.decode("At", f.format.encode(want))
+				if err != nil {
+					t.Fatalf("decode() error = %v", err)
+				}
+				if !got.Equal(want.Truncate(f.precision)) {
+					t.Errorf("decode() = %v, want %v", got, want.Truncate(f.precision))
+				}
+			})
+		}
+	}
+}
+
+func TestTimeFormatDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		format TimeFormat
+		value  interface{}
+	}{
+		{"string for milli", TimeFormatMilli, "2020-09-13T12:26:40Z"},
+		{"int for rfc3339", TimeFormatRFC3339, int64(1600000000)},
+		{"invalid rfc3339", TimeFormatRFC3339, "yesterday"},
+		{"float", TimeFormatSecond, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.format.decode("At", tt.value); err == nil {
+				t.Errorf("decode(%v) expected error", tt.value)
+			}
+		})
+	}
+}
+
+func TestZeroTimeIsUnset(t *testing.T) {
+	type event struct {
+		At        time.Time  `json:"at"`
+		ShippedAt *time.Time `json:"shippedAt"`
+	}
+	now := time.Now()
+	tests := []struct {
+		name   string
+		obj    *event
+		field  string
+		wantOK bool
+	}{
+		{"zero time", &event{}, "At", false},
+		{"time", &event{At: now}, "At", true},
+		{"nil pointer", &event{}, "ShippedAt", false},
+		{"pointer to zero time", &event{ShippedAt: &time.Time{}}, "ShippedAt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := getColumnValue(tt.obj, tt.field)
+			if err != nil {
+				t.Fatalf("getColumnValue() error = %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("getColumnValue() ok = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package tableorm
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/oleiade/reflections"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//自动时间戳的精度
+type TimestampPrecision int
+
+const (
+	TimestampSecond TimestampPrecision = iota
+	TimestampMilli
+	TimestampNano
+)
+
+//没有在tag中指定精度时使用的默认精度，例如 tableorm:"autoUpdateTime:milli"
+var DefaultTimestampPrecision = TimestampSecond
+
+var tagToTimestampPrecisionMap = map[string]TimestampPrecision{
+	"":      TimestampSecond,
+	"milli": TimestampMilli,
+	"nano":  TimestampNano,
+}
+
+//返回当前时间对应精度的时间戳
+func (p TimestampPrecision) Now() int64 {
+	now := time.Now()
+	switch p {
+	case TimestampMilli:
+		return now.UnixNano() / int64(time.Millisecond)
+	case TimestampNano:
+		return now.UnixNano()
+	default:
+		return now.Unix()
+	}
+}
+
+//自动时间戳字段，key为字段名
+type autoTimeFields struct {
+	create map[string]TimestampPrecision
+	update map[string]TimestampPrecision
+}
+
+//解析tableorm tag，多个选项用分号分隔，选项值用冒号分隔，例如 tableorm:"autoCreateTime:milli"
+func parseTableormTag(tag string) map[string]string {
+	settings := map[string]string{}
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) == 2 {
+			settings[kv[0]] = strings.TrimSpace(kv[1])
+		} else {
+			settings[kv[0]] = ""
+		}
+	}
+	return settings
+}
+
+//查找自动时间戳字段，字段名为CreatedAt/UpdatedAt，或者通过tag标记
+//未存入数据库的字段（没有json tag或者为"-"）会被忽略
+//只有数字和时间类型可以自动填充，按字段名匹配到其他类型时忽略，通过tag标记时返回错误
+func getAutoTimeFields(obj interface{}) (*autoTimeFields, error) {
+	fieldToJSONMap, _, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := getModelFieldNames(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &autoTimeFields{
+		create: map[string]TimestampPrecision{},
+		update: map[string]TimestampPrecision{},
+	}
+	for _, field := range fields {
+		if fieldToJSONMap[field] == "" {
+			continue
+		}
+
+		tag, _ := reflections.GetFieldTag(obj, field, "tableorm")
+		settings := parseTableormTag(tag)
+		typ, _ := getFieldType(obj, field)
+		supported := typ != nil && isAutoTimeType(typ)
+
+		if value, ok := settings["autoCreateTime"]; ok {
+			if !supported {
+				return nil, fmt.Errorf("autoCreateTime field %s must be number or time.Time, it's %s now", field, typ)
+			}
+			precision, err := parseTimestampPrecision(field, value)
+			if err != nil {
+				return nil, err
+			}
+			result.create[field] = precision
+		} else if field == "CreatedAt" && supported {
+			result.create[field] = DefaultTimestampPrecision
+		}
+
+		if value, ok := settings["autoUpdateTime"]; ok {
+			if !supported {
+				return nil, fmt.Errorf("autoUpdateTime field %s must be number or time.Time, it's %s now", field, typ)
+			}
+			precision, err := parseTimestampPrecision(field, value)
+			if err != nil {
+				return nil, err
+			}
+			result.update[field] = precision
+		} else if field == "UpdatedAt" && supported {
+			result.update[field] = DefaultTimestampPrecision
+		}
+	}
+
+	return result, nil
+}
+
+//可以自动填充的类型：整数、浮点数（包括底层为数字的自定义类型）以及time.Time、*time.Time、sql.NullTime
+func isAutoTimeType(typ reflect.Type) bool {
+	return isNumberKind(typ.Kind()) || isTimeType(typ)
+}
+
+func parseTimestampPrecision(field, value string) (TimestampPrecision, error) {
+	if value == "" {
+		return DefaultTimestampPrecision, nil
+	}
+	precision, ok := tagToTimestampPrecisionMap[value]
+	if !ok {
+		return 0, fmt.Errorf("unexpected timestamp precision %s %s", field, value)
+	}
+	return precision, nil
+}
+
+//填充自动时间戳，创建时间只在为空时填充，更新时间每次都会覆盖
+func (f *autoTimeFields) fill(obj interface{}, isCreate bool) error {
+	if isCreate {
+		for field, precision := range f.create {
+			value, err := reflections.GetField(obj, field)
+			if err != nil {
+				return err
+			}
+			if !reflect.ValueOf(value).IsZero() {
+				continue
+			}
+			value, err = autoTimeValue(obj, field, precision)
+			if err != nil {
+				return err
+			}
+			if err := reflections.SetField(obj, field, value); err != nil {
+				return fmt.Errorf("set field %s error: %w", field, err)
+			}
+		}
+	}
+
+	for field, precision := range f.update {
+		value, err := autoTimeValue(obj, field, precision)
+		if err != nil {
+			return err
+		}
+		if err := reflections.SetField(obj, field, value); err != nil {
+			return fmt.Errorf("set field %s error: %w", field, err)
+		}
+	}
+	return nil
+}
+
+//时间字段直接填充当前时间，精度由存储格式决定，其余字段填充对应精度的时间戳
+//int32等较小的整数类型无法容纳当前时间戳时返回溢出错误
+func autoTimeValue(obj interface{}, field string, precision TimestampPrecision) (interface{}, error) {
+	typ, ok := getFieldType(obj, field)
+	if !ok {
+		return precision.Now(), nil
+	}
+	if isNumberKind(typ.Kind()) {
+		return toFieldNumber(field, precision.Now(), typ)
+	}
+	if !isTimeType(typ) {
+		return precision.Now(), nil
+	}
+	now := time.Now()
+	switch {
+	case typ.Kind() == reflect.Ptr:
+		return &now, nil
+	case typ == nullTimeType:
+		return sql.NullTime{Time: now, Valid: true}, nil
+	}
+	return now, nil
+}
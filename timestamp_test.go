@@ -0,0 +1,186 @@
+package tableorm
+
+import (
+	"testing"
+	"time"
+)
+
+type timestampPost struct {
+	ID        string `json:"_id"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	PublishAt int64  `json:"publish_at" tableorm:"autoCreateTime:milli"`
+	EditedAt  int64  `json:"edited_at" tableorm:"autoUpdateTime:nano"`
+	Ignored   int64  `json:"-" tableorm:"autoUpdateTime"`
+}
+
+type timestampBadPrecision struct {
+	ID        string `json:"_id"`
+	CreatedAt int64  `json:"created_at" tableorm:"autoCreateTime:hour"`
+}
+
+func TestTimestampPrecisionNow(t *testing.T) {
+	before := time.Now()
+	second := TimestampSecond.Now()
+	milli := TimestampMilli.Now()
+	nano := TimestampNano.Now()
+	after := time.Now()
+
+	if second < before.Unix() || second > after.Unix() {
+		t.Errorf("TimestampSecond.Now() = %d, want between %d and %d", second, before.Unix(), after.Unix())
+	}
+	if min, max := before.UnixNano()/1e6, after.UnixNano()/1e6; milli < min || milli > max {
+		t.Errorf("TimestampMilli.Now() = %d, want between %d and %d", milli, min, max)
+	}
+	if nano < before.UnixNano() || nano > after.UnixNano() {
+		t.Errorf("TimestampNano.Now() = %d, want between %d and %d", nano, before.UnixNano(), after.UnixNano())
+	}
+}
+
+func TestGetAutoTimeFields(t *testing.T) {
+	fields, err := getAutoTimeFields(&timestampPost{})
+	if err != nil {
+		t.Fatalf("getAutoTimeFields() error = %v", err)
+	}
+
+	wantCreate := map[string]TimestampPrecision{"CreatedAt": DefaultTimestampPrecision, "PublishAt": TimestampMilli}
+	wantUpdate := map[string]TimestampPrecision{"UpdatedAt": DefaultTimestampPrecision, "EditedAt": TimestampNano}
+	if len(fields.create) != len(wantCreate) || len(fields.update) != len(wantUpdate) {
+		t.Fatalf("getAutoTimeFields() = %v %v, want %v %v", fields.create, fields.update, wantCreate, wantUpdate)
+	}
+	for field, precision := range wantCreate {
+		if got, ok := fields.create[field]; !ok || got != precision {
+			t.Errorf("create[%s] = %v, want %v", field, got, precision)
+		}
+	}
+	for field, precision := range wantUpdate {
+		if got, ok := fields.update[field]; !ok || got != precision {
+			t.Errorf("update[%s] = %v, want %v", field, got, precision)
+		}
+	}
+}
+
+func TestGetAutoTimeFieldsBadPrecision(t *testing.T) {
+	if _, err := getAutoTimeFields(&timestampBadPrecision{}); err == nil {
+		t.Fatal("getAutoTimeFields() should reject unknown precision")
+	}
+}
+
+func TestFillAutoTimeFields(t *testing.T) {
+	fields, err := getAutoTimeFields(&timestampPost{})
+	if err != nil {
+		t.Fatalf("getAutoTimeFields() error = %v", err)
+	}
+
+	post := &timestampPost{PublishAt: 1}
+	if err := fields.fill(post, true); err != nil {
+		t.Fatalf("fill() create error = %v", err)
+	}
+	if post.CreatedAt == 0 || post.UpdatedAt == 0 || post.EditedAt == 0 {
+		t.Errorf("fill() create = %+v, want timestamps set", post)
+	}
+	if post.PublishAt != 1 {
+		t.Errorf("fill() create overwrote PublishAt = %d, want 1", post.PublishAt)
+	}
+	if post.Ignored != 0 {
+		t.Errorf("fill() set field without column, Ignored = %d", post.Ignored)
+	}
+
+	post = &timestampPost{CreatedAt: 100, UpdatedAt: 100}
+	if err := fields.fill(post, false); err != nil {
+		t.Fatalf("fill() update error = %v", err)
+	}
+	if post.CreatedAt != 100 {
+		t.Errorf("fill() update changed CreatedAt = %d, want 100", post.CreatedAt)
+	}
+	if post.UpdatedAt <= 100 {
+		t.Errorf("fill() update UpdatedAt = %d, want refreshed", post.UpdatedAt)
+	}
+	if post.PublishAt != 0 {
+		t.Errorf("fill() update set PublishAt = %d, want 0", post.PublishAt)
+	}
+}
+
+//字段名为CreatedAt/UpdatedAt但不是数字或时间类型时不自动填充
+type timestampStringNames struct {
+	ID        string `json:"_id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt *int64 `json:"updated_at"`
+}
+
+type timestampBadTag struct {
+	ID       string `json:"_id"`
+	EditedBy string `json:"edited_by" tableorm:"autoUpdateTime"`
+}
+
+func TestAutoTimeFieldsSkipUnsupportedNames(t *testing.T) {
+	fields, err := getAutoTimeFields(&timestampStringNames{})
+	if err != nil {
+		t.Fatalf("getAutoTimeFields() error = %v", err)
+	}
+	if len(fields.create) != 0 || len(fields.update) != 0 {
+		t.Errorf("getAutoTimeFields() = %v %v, want none", fields.create, fields.update)
+	}
+	if err := CheckModel(&timestampStringNames{}); err != nil {
+		t.Errorf("CheckModel() error = %v", err)
+	}
+
+	obj := &timestampStringNames{ID: "1", CreatedAt: "yesterday"}
+	if _, err := GetSaveRowChange(obj); err != nil {
+		t.Fatalf("GetSaveRowChange() error = %v", err)
+	}
+	if obj.CreatedAt != "yesterday" || obj.UpdatedAt != nil {
+		t.Errorf("string fields changed to %+v", obj)
+	}
+}
+
+func TestAutoTimeFieldsRejectUnsupportedTag(t *testing.T) {
+	if _, err := getAutoTimeFields(&timestampBadTag{}); err == nil {
+		t.Error("getAutoTimeFields() should reject autoUpdateTime on string field")
+	}
+	if err := CheckModel(&timestampBadTag{}); err == nil {
+		t.Error("CheckModel() should reject autoUpdateTime on string field")
+	}
+}
+
+func TestFillAutoTimeFieldsPrecision(t *testing.T) {
+	fields, err := getAutoTimeFields(&timestampPost{})
+	if err != nil {
+		t.Fatalf("getAutoTimeFields() error = %v", err)
+	}
+
+	before := time.Now()
+	post := &timestampPost{}
+	if err := fields.fill(post, true); err != nil {
+		t.Fatalf("fill() error = %v", err)
+	}
+	after := time.Now()
+
+	if post.CreatedAt < before.Unix() || post.CreatedAt > after.Unix() {
+		t.Errorf("CreatedAt = %d, want seconds", post.CreatedAt)
+	}
+	if min, max := before.UnixNano()/1e6, after.UnixNano()/1e6; post.PublishAt < min || post.PublishAt > max {
+		t.Errorf("PublishAt = %d, want milliseconds", post.PublishAt)
+	}
+	if post.EditedAt < before.UnixNano() || post.EditedAt > after.UnixNano() {
+		t.Errorf("EditedAt = %d, want nanoseconds", post.EditedAt)
+	}
+}
+
+//更新时不写入创建时间，保留数据库中原有的值
+func TestUpdateRowChangeKeepsCreatedAt(t *testing.T) {
+	rowChange, err := GetUpdateRowChange(&timestampPost{ID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := map[string]bool{}
+	for _, column := range rowChange.Columns {
+		columns[column.ColumnName] = true
+	}
+	if columns["created_at"] || columns["publish_at"] {
+		t.Errorf("update columns = %v, want no create time columns", columns)
+	}
+	if !columns["updated_at"] || !columns["edited_at"] {
+		t.Errorf("update columns = %v, want update time columns", columns)
+	}
+}
@@ -0,0 +1,144 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"log"
+)
+
+//局部事务，TableStore只支持同一张表内同一个分区键下的多行原子读写
+//事务在第一次读写时根据obj确定表名后开启，之后只能读写这张表
+//分区键为第一个主键列，没有指定复合主键时即为_id
+type Tx struct {
+	db            *DB
+	partitionKey  interface{}
+	tableName     string
+	transactionID *string
+}
+
+//在partitionKey对应的分区内开启局部事务并执行fc
+//fc返回nil时提交，返回错误或panic时回滚，panic会在回滚后继续抛出
+func (db *DB) Transaction(partitionKey interface{}, fc func(tx *Tx) error) (err error) {
+	tx := &Tx{
+		db:           db,
+		partitionKey: partitionKey,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if abortErr := tx.abort(); abortErr != nil {
+				log.Printf("abort transaction error %s", abortErr)
+			}
+			panic(r)
+		}
+	}()
+
+	if err = fc(tx); err != nil {
+		if abortErr := tx.abort(); abortErr != nil {
+			log.Printf("abort transaction error %s", abortErr)
+		}
+		return err
+	}
+
+	return tx.commit()
+}
+
+func (tx *Tx) Get(obj interface{}) error {
+	if err := tx.begin(obj); err != nil {
+		return err
+	}
+	return tx.db.get(obj, tx.transactionID)
+}
+
+//覆盖写入单行
+func (tx *Tx) Save(obj interface{}) error {
+	if err := tx.begin(obj); err != nil {
+		return err
+	}
+
+	rowChange, err := tx.db.GetSaveRowChange(obj)
+	if err != nil {
+		return err
+	}
+	rowChange.TransactionId = tx.transactionID
+
+	return tx.db.putRow(obj, rowChange)
+}
+
+func (tx *Tx) Create(obj interface{}) error {
+	if err := tx.begin(obj); err != nil {
+		return err
+	}
+	return tx.db.create(obj, tx.transactionID)
+}
+
+func (tx *Tx) Update(obj interface{}) error {
+	if err := tx.begin(obj); err != nil {
+		return err
+	}
+	return tx.db.update(obj, tx.transactionID)
+}
+
+func (tx *Tx) Delete(obj interface{}) error {
+	if err := tx.begin(obj); err != nil {
+		return err
+	}
+
+	rowChange, err := tx.db.GetDeleteRowChange(obj)
+	if err != nil {
+		return err
+	}
+	rowChange.TransactionId = tx.transactionID
+
+	_, err = tx.db.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: rowChange})
+	return err
+}
+
+//第一次读写时开启事务，已开启时检查是否为同一张表
+func (tx *Tx) begin(obj interface{}) error {
+	tableName := tx.db.tableName(obj)
+	if tx.transactionID != nil {
+		if tableName != tx.tableName {
+			return fmt.Errorf("transaction is bound to table %s, can not access table %s", tx.tableName, tableName)
+		}
+		return nil
+	}
+
+	pk, err := buildPartitionKey(obj, tx.partitionKey)
+	if err != nil {
+		return err
+	}
+
+	resp, err := tx.db.client.StartLocalTransaction(&tablestore.StartLocalTransactionRequest{
+		TableName:  tableName,
+		PrimaryKey: pk,
+	})
+	if err != nil {
+		return err
+	}
+
+	tx.tableName = tableName
+	tx.transactionID = resp.TransactionId
+	return nil
+}
+
+//没有任何读写时事务没有开启，无需提交
+func (tx *Tx) commit() error {
+	if tx.transactionID == nil {
+		return nil
+	}
+	_, err := tx.db.client.CommitTransaction(&tablestore.CommitTransactionRequest{
+		TransactionId: tx.transactionID,
+	})
+	return err
+}
+
+func (tx *Tx) abort() error {
+	if tx.transactionID == nil {
+		return nil
+	}
+	_, err := tx.db.client.AbortTransaction(&tablestore.AbortTransactionRequest{
+		TransactionId: tx.transactionID,
+	})
+	return err
+}
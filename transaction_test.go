@@ -0,0 +1,71 @@
+package tableorm
+
+import (
+	"errors"
+	"testing"
+)
+
+type txAccount struct {
+	ID      string `json:"_id"`
+	Balance int64  `json:"balance"`
+}
+
+type txLedger struct {
+	ID     string `json:"_id"`
+	Amount int64  `json:"amount"`
+}
+
+func newTestDB() *DB {
+	return NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+}
+
+func TestTransactionWithoutAccessCommitsNothing(t *testing.T) {
+	db := newTestDB()
+	err := db.Transaction("user1", func(tx *Tx) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
+
+func TestTransactionReturnsError(t *testing.T) {
+	db := newTestDB()
+	want := errors.New("insufficient balance")
+	err := db.Transaction("user1", func(tx *Tx) error {
+		return want
+	})
+	if err != want {
+		t.Fatalf("Transaction() error = %v, want %v", err, want)
+	}
+}
+
+func TestTransactionRethrowsPanic(t *testing.T) {
+	db := newTestDB()
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("recover() = %v, want boom", r)
+		}
+	}()
+	db.Transaction("user1", func(tx *Tx) error {
+		panic("boom")
+	})
+	t.Fatal("Transaction() did not rethrow the panic")
+}
+
+func TestTxBoundToFirstTable(t *testing.T) {
+	id := "transaction-id"
+	tx := &Tx{
+		db:            newTestDB(),
+		partitionKey:  "user1",
+		tableName:     GetTableName(&txAccount{}),
+		transactionID: &id,
+	}
+
+	if err := tx.begin(&txAccount{ID: "user1"}); err != nil {
+		t.Fatalf("begin() same table error = %v", err)
+	}
+	if err := tx.begin(&txLedger{ID: "user1"}); err == nil {
+		t.Fatal("begin() on another table should fail")
+	}
+}
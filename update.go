@@ -4,18 +4,40 @@ import (
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 )
 
-//批量保存，并返回保存后的对象，方便获取ID
+//批量保存，并返回传入的对象，方便获取ID
+//支持传入 *T、T、[]T、[]*T，生成的ID会回填到调用方的数据中
+//直接传入结构体值时无法回填，此时ID必须已经设置，否则返回NotAddressable
+//有自增主键的行需要服务端返回生成的ID，BatchWriteRow不返回主键，这些行逐行通过PutRow写入，其余行仍然批量写入
+//逐行写入时中途失败，之前的行已经写入，批量部分不会执行
 func (db *DB) Save(objList ...interface{}) ([]interface{}, error) {
+	rows, err := expandObjects(objList)
+	if err != nil {
+		return nil, err
+	}
+
 	batchWriteReq := &tablestore.BatchWriteRowRequest{}
 
-	for _, obj := range objList {
-		rowChange, err := GetSaveRowChange(obj)
+	for _, row := range rows {
+		obj := row.obj
+		rowChange, err := row.saveRowChange(db)
 		if err != nil {
 			return nil, err
 		}
+
+		//批量写入不返回主键，需要回填自增ID的行单独写入
+		if rowChange.ReturnType == tablestore.ReturnType_RT_PK {
+			if err := db.putRow(obj, rowChange); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		batchWriteReq.AddRowChange(rowChange)
 	}
 
+	if len(batchWriteReq.RowChangesGroupByTable) == 0 {
+		return objList, nil
+	}
+
 	resp, err := db.client.BatchWriteRow(batchWriteReq)
 	if err != nil {
 		return nil, err
@@ -24,11 +46,30 @@ func (db *DB) Save(objList ...interface{}) ([]interface{}, error) {
 	return objList, GetBatchWriteResult(resp)
 }
 
+//写入单行，服务端返回主键时（自增ID）回填到obj中
+func (db *DB) putRow(obj interface{}, rowChange *tablestore.PutRowChange) error {
+	resp, err := db.client.PutRow(&tablestore.PutRowRequest{PutRowChange: rowChange})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return nil
+	}
+	return loadPrimaryKey(obj, &resp.PrimaryKey)
+}
+
+//批量删除，支持传入 *T、T、[]T、[]*T
 func (db *DB) Delete(objList ...interface{}) error {
+	rows, err := expandObjects(objList)
+	if err != nil {
+		return err
+	}
+
 	batchWriteReq := &tablestore.BatchWriteRowRequest{}
 
-	for _, obj := range objList {
-		rowChange, err := GetDeleteRowChange(obj)
+	for _, row := range rows {
+		rowChange, err := db.GetDeleteRowChange(row.obj)
 		if err != nil {
 			return err
 		}
@@ -42,3 +83,42 @@ func (db *DB) Delete(objList ...interface{}) error {
 
 	return GetBatchWriteResult(resp)
 }
+
+//创建单行，行已存在时返回RowAlreadyExist，不会覆盖已有数据
+func (db *DB) Create(obj interface{}) error {
+	return db.create(obj, nil)
+}
+
+//更新单行，行不存在时返回RowNotExist，不会创建新行
+func (db *DB) Update(obj interface{}) error {
+	return db.update(obj, nil)
+}
+
+//transactionID不为空时在局部事务中执行
+func (db *DB) create(obj interface{}, transactionID *string) error {
+	rowChange, err := db.GetCreateRowChange(obj)
+	if err != nil {
+		return err
+	}
+	rowChange.TransactionId = transactionID
+
+	err = db.putRow(obj, rowChange)
+	if isConditionCheckFail(err) {
+		return RowAlreadyExist
+	}
+	return err
+}
+
+func (db *DB) update(obj interface{}, transactionID *string) error {
+	rowChange, err := db.GetUpdateRowChange(obj)
+	if err != nil {
+		return err
+	}
+	rowChange.TransactionId = transactionID
+
+	_, err = db.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: rowChange})
+	if isConditionCheckFail(err) {
+		return RowNotExist
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package tableorm
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandObjects(t *testing.T) {
+	user := upsertUser{ID: "a"}
+	users := []upsertUser{{ID: "b"}, {ID: "c"}}
+	pointers := []*upsertUser{{ID: "d"}}
+	array := [1]upsertUser{{ID: "e"}}
+
+	rows, err := expandObjects([]interface{}{&user, user, users, pointers, &users, array})
+	if err != nil {
+		t.Fatalf("expandObjects() error = %v", err)
+	}
+
+	want := []struct {
+		id          string
+		addressable bool
+	}{
+		{"a", true},
+		{"a", false},
+		{"b", true},
+		{"c", true},
+		{"d", true},
+		{"b", true},
+		{"c", true},
+		{"e", false},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expandObjects() returned %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		obj, ok := rows[i].obj.(*upsertUser)
+		if !ok || obj.ID != w.id || rows[i].addressable != w.addressable {
+			t.Errorf("rows[%d] = %+v addressable %v, want %s addressable %v", i, rows[i].obj, rows[i].addressable, w.id, w.addressable)
+		}
+	}
+
+	//可回写的对象指向调用方的数据
+	rows[0].obj.(*upsertUser).Name = "pointer"
+	rows[2].obj.(*upsertUser).Name = "slice"
+	rows[1].obj.(*upsertUser).Name = "copy"
+	if user.Name != "pointer" || users[0].Name != "slice" {
+		t.Errorf("addressable rows not shared with caller: %+v %+v", user, users[0])
+	}
+}
+
+func TestExpandObjectsError(t *testing.T) {
+	var nilUser *upsertUser
+	for _, obj := range []interface{}{nilUser, 1, "user"} {
+		if _, err := expandObjects([]interface{}{obj}); err == nil {
+			t.Errorf("expandObjects(%T) expected error", obj)
+		}
+	}
+}
+
+//值类型无法回填生成的ID
+func TestSaveValueWithoutID(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	if _, err := db.Save(upsertUser{Name: "sam"}); !errors.Is(err, NotAddressable) {
+		t.Errorf("Save() error = %v, want %v", err, NotAddressable)
+	}
+}
+
+func TestDeleteRejectsEmptyPrimaryKey(t *testing.T) {
+	//主键为空时在请求服务端之前返回错误，地址不需要可用
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	tests := []struct {
+		name string
+		objs []interface{}
+	}{
+		{"pointer", []interface{}{&UserProfile{}}},
+		{"value", []interface{}{UserProfile{}}},
+		{"slice", []interface{}{[]UserProfile{{ID: "1"}, {}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Delete(tt.objs...)
+			if err == nil || !strings.Contains(err.Error(), "primary key is empty") {
+				t.Errorf("Delete() error = %v, want primary key is empty", err)
+			}
+		})
+	}
+
+	if _, err := GetDeleteRowChange(&UserProfile{ID: "1"}); err != nil {
+		t.Errorf("GetDeleteRowChange() error = %v", err)
+	}
+}
+
+type nullableProfile struct {
+	ID       string         `json:"_id"`
+	Remark   string         `json:"remark,omitempty"`
+	Nickname *string        `json:"nickname"`
+	Phone    sql.NullString `json:"phone"`
+	Birthday time.Time      `json:"birthday"`
+	Age      int64          `json:"age"`
+}
+
+func TestUpdateRowChangeNullableFields(t *testing.T) {
+	nickname := "sam"
+	tests := []struct {
+		name string
+		obj  *nullableProfile
+		//列名对应的操作，put或delete，没有出现的列被跳过
+		want map[string]string
+	}{
+		{
+			name: "zero values",
+			obj:  &nullableProfile{ID: "1"},
+			want: map[string]string{"nickname": "delete", "phone": "delete", "age": "put"},
+		},
+		{
+			name: "set values",
+			obj: &nullableProfile{ID: "1", Remark: "vip", Nickname: &nickname,
+				Phone: sql.NullString{String: "123", Valid: true}, Birthday: time.Unix(0, 0), Age: 1},
+			want: map[string]string{"remark": "put", "nickname": "put", "phone": "put", "birthday": "put", "age": "put"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rowChange, err := GetUpdateRowChange(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, column := range rowChange.Columns {
+				if column.IgnoreValue {
+					got[column.ColumnName] = "delete"
+				} else {
+					got[column.ColumnName] = "put"
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/oleiade/reflections"
+	"reflect"
+)
+
+//查询第一条记录，没有找到时保留obj中已有的值，不报错
+func (db *DB) FirstOrInit(obj interface{}, queries ...search.Query) error {
+	err := db.Query(queries...).First(obj)
+	if err == NotResultFound {
+		return nil
+	}
+	return err
+}
+
+//查询第一条记录，没有找到时把查询条件中的精确匹配赋值给obj，再用obj中的值创建
+//多元索引是异步同步的，并发时可能都查不到，因此创建时使用条件写入，只有一个调用方能创建成功，其余的会读取已创建的行
+//条件写入只能按主键去重，因此主键必须由调用方设置或者来自查询条件，不能自动生成，否则返回PrimaryKeyEmpty
+func (db *DB) FirstOrCreate(obj interface{}, queries ...search.Query) error {
+	err := db.Query(queries...).First(obj)
+	if err != NotResultFound {
+		return err
+	}
+
+	if err := assignQueryConditions(obj, queries...); err != nil {
+		return err
+	}
+	if err := checkPrimaryKeySet(obj); err != nil {
+		return err
+	}
+
+	err = db.Create(obj)
+	if err == RowAlreadyExist {
+		return db.Get(obj)
+	}
+	return err
+}
+
+//行不存在时创建，存在时更新，created表示本次是否为创建
+//先以期望行不存在的条件写入，失败再以期望行存在的条件更新，保证并发时不会重复创建
+//主键必须由调用方设置，不能自动生成，否则返回PrimaryKeyEmpty
+func (db *DB) CreateOrUpdate(obj interface{}) (created bool, err error) {
+	if err := checkPrimaryKeySet(obj); err != nil {
+		return false, err
+	}
+
+	err = db.Create(obj)
+	if err == nil {
+		return true, nil
+	}
+	if err != RowAlreadyExist {
+		return false, err
+	}
+
+	return false, db.Update(obj)
+}
+
+//检查主键是否都已设置，自动生成的主键每次都不同，无法通过条件写入避免重复创建
+func checkPrimaryKeySet(obj interface{}) error {
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return err
+	}
+
+	for _, pkField := range pkFields {
+		if pkField.Generator != nil && isAutoIncrement(pkField.Generator) {
+			return fmt.Errorf("%w: auto increment primary key %s is generated by server", PrimaryKeyEmpty, pkField.Field)
+		}
+		value, err := reflections.GetField(obj, pkField.Field)
+		if err != nil {
+			return err
+		}
+		if reflect.ValueOf(value).IsZero() {
+			return fmt.Errorf("%w: %s is empty", PrimaryKeyEmpty, pkField.Field)
+		}
+	}
+	return nil
+}
+
+//把查询条件中的精确匹配赋值给obj，与gorm一致，只处理TermQuery和只有一个值的TermsQuery，包括BoolQuery中must和filter的子查询
+//查询条件中的值先按字段类型转换为列值，再像读取一样写入字段
+func assignQueryConditions(obj interface{}, queries ...search.Query) error {
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return err
+	}
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return err
+	}
+
+	terms := map[string][]interface{}{}
+	for _, query := range queries {
+		converted, err := convertQueryValues(obj, query)
+		if err != nil {
+			return err
+		}
+		collectTerms(converted, terms)
+	}
+
+	for column, values := range terms {
+		field, ok := jsonToFieldMap[column]
+		if !ok || len(values) != 1 {
+			continue
+		}
+		value := values[0]
+		//分区键在索引中存储的是带哈希前缀的值，还原为业务ID
+		if column == pkFields[0].Column {
+			value, err = decodeID(obj, value)
+			if err != nil {
+				return err
+			}
+		}
+		if err := setFieldValue(obj, field, value); err != nil {
+			return fmt.Errorf("assign query condition %s error: %w", column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package tableorm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/diemus/tableorm/query"
+	"testing"
+	"time"
+)
+
+type upsertUser struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Age  int64  `json:"age"`
+}
+
+func TestRowChangeConditions(t *testing.T) {
+	saveRowChange, err := GetSaveRowChange(&upsertUser{ID: "user-1"})
+	if err != nil {
+		t.Fatalf("GetSaveRowChange() error = %v", err)
+	}
+	if got := saveRowChange.Condition.RowExistenceExpectation; got != tablestore.RowExistenceExpectation_IGNORE {
+		t.Errorf("save condition = %v, want IGNORE", got)
+	}
+
+	createRowChange, err := GetCreateRowChange(&upsertUser{ID: "user-1"})
+	if err != nil {
+		t.Fatalf("GetCreateRowChange() error = %v", err)
+	}
+	if got := createRowChange.Condition.RowExistenceExpectation; got != tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST {
+		t.Errorf("create condition = %v, want EXPECT_NOT_EXIST", got)
+	}
+
+	updateRowChange, err := GetUpdateRowChange(&upsertUser{ID: "user-1", Name: "sam", Age: 18})
+	if err != nil {
+		t.Fatalf("GetUpdateRowChange() error = %v", err)
+	}
+	if got := updateRowChange.Condition.RowExistenceExpectation; got != tablestore.RowExistenceExpectation_EXPECT_EXIST {
+		t.Errorf("update condition = %v, want EXPECT_EXIST", got)
+	}
+	if pk := updateRowChange.PrimaryKey.PrimaryKeys[0]; pk.ColumnName != "_id" || pk.Value != "user-1" {
+		t.Errorf("update primary key = %s=%v, want _id=user-1", pk.ColumnName, pk.Value)
+	}
+	columns := map[string]interface{}{}
+	for _, column := range updateRowChange.Columns {
+		columns[column.ColumnName] = column.Value
+	}
+	if len(columns) != 2 || columns["name"] != "sam" || columns["age"] != int64(18) {
+		t.Errorf("update columns = %v, want name and age", columns)
+	}
+}
+
+func TestGetUpdateRowChangeRequiresID(t *testing.T) {
+	if _, err := GetUpdateRowChange(&upsertUser{Name: "sam"}); err == nil {
+		t.Error("GetUpdateRowChange() expected error for empty _id")
+	}
+}
+
+func TestIsConditionCheckFail(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"condition check fail", &tablestore.OtsError{Code: conditionCheckFailCode}, true},
+		{"wrapped", fmt.Errorf("put row: %w", &tablestore.OtsError{Code: conditionCheckFailCode}), true},
+		{"other code", &tablestore.OtsError{Code: "OTSServerBusy"}, false},
+		{"other error", fmt.Errorf("network error"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConditionCheckFail(tt.err); got != tt.want {
+				t.Errorf("isConditionCheckFail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPrimaryKeySet(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     interface{}
+		wantErr bool
+	}{
+		{"set", &upsertUser{ID: "user-1"}, false},
+		{"empty", &upsertUser{Name: "sam"}, true},
+		{"composite set", &hashPrefixMetric{Tenant: 1, Name: "cpu"}, false},
+		{"composite partly empty", &hashPrefixMetric{Tenant: 1}, true},
+		{"auto increment", &idAutoIncrementModel{Tenant: "t1", Seq: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPrimaryKeySet(tt.obj)
+			if tt.wantErr != errors.Is(err, PrimaryKeyEmpty) {
+				t.Errorf("checkPrimaryKeySet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+//主键为空时每次创建都会生成新的ID，并发时会重复创建，因此直接报错，不发出请求
+func TestCreateOrUpdateRequiresPrimaryKey(t *testing.T) {
+	db := NewDB("http://127.0.0.1:1", "test", "ak", "sk")
+	if _, err := db.CreateOrUpdate(&upsertUser{Name: "sam"}); !errors.Is(err, PrimaryKeyEmpty) {
+		t.Errorf("CreateOrUpdate() error = %v, want %v", err, PrimaryKeyEmpty)
+	}
+}
+
+func TestAssignQueryConditions(t *testing.T) {
+	user := &upsertUser{Age: 1}
+	err := assignQueryConditions(user,
+		query.TermQuery("_id", "user-1"),
+		query.And(query.TermQuery("name", "sam"), &search.RangeQuery{FieldName: "age", From: 10}),
+		&search.TermsQuery{FieldName: "unknown", Terms: []interface{}{"x"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user != (upsertUser{ID: "user-1", Name: "sam", Age: 1}) {
+		t.Errorf("user = %+v", user)
+	}
+
+	//只有一个值的TermsQuery视为精确匹配，多个值时无法确定，不赋值
+	user = &upsertUser{}
+	err = assignQueryConditions(user,
+		&search.TermsQuery{FieldName: "age", Terms: []interface{}{18}},
+		&search.TermsQuery{FieldName: "name", Terms: []interface{}{"sam", "tom"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user != (upsertUser{Age: 18}) {
+		t.Errorf("user = %+v", user)
+	}
+}
+
+func TestAssignQueryConditionsConvertsValues(t *testing.T) {
+	at := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	event := &timeEvent{}
+	if err := assignQueryConditions(event, query.TermQuery("day", at), query.TermQuery("count", 3)); err != nil {
+		t.Fatal(err)
+	}
+	if !event.Day.Equal(at) || event.Count != 3 {
+		t.Errorf("event = %+v", event)
+	}
+
+	//分区键开启哈希前缀时，索引中存储的是带前缀的值
+	user := &hashPrefixUser{}
+	if err := assignQueryConditions(user, query.TermQuery("_id", AddHashPrefix("user-1"))); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "user-1" {
+		t.Errorf("ID = %q, want user-1", user.ID)
+	}
+}
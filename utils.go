@@ -1,13 +1,14 @@
 package tableorm
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 	"github.com/golang/protobuf/proto"
 	"github.com/oleiade/reflections"
-	uuid "github.com/satori/go.uuid"
 	"reflect"
 	"strings"
+	"time"
 )
 
 var (
@@ -19,6 +20,11 @@ var (
 		"nested": tablestore.FieldType_NESTED,
 		"text":   tablestore.FieldType_TEXT,
 		"geo":    tablestore.FieldType_GEO_POINT,
+		//与TableStore的索引类型同名，便于对照文档
+		"keyword": tablestore.FieldType_KEYWORD,
+		"long":    tablestore.FieldType_LONG,
+		"double":  tablestore.FieldType_DOUBLE,
+		"boolean": tablestore.FieldType_BOOLEAN,
 	}
 
 	kindToIndexTypeMap = map[reflect.Kind]tablestore.FieldType{
@@ -27,12 +33,37 @@ var (
 		reflect.String:  tablestore.FieldType_KEYWORD,
 		reflect.Int64:   tablestore.FieldType_LONG,
 		//reflect.Uint8:   tablestore.FieldType_KEYWORD, //[]bytes?
+		//其他数字类型写入时扩展为int64、float64
+		reflect.Int:     tablestore.FieldType_LONG,
+		reflect.Int8:    tablestore.FieldType_LONG,
+		reflect.Int16:   tablestore.FieldType_LONG,
+		reflect.Int32:   tablestore.FieldType_LONG,
+		reflect.Uint:    tablestore.FieldType_LONG,
+		reflect.Uint8:   tablestore.FieldType_LONG,
+		reflect.Uint16:  tablestore.FieldType_LONG,
+		reflect.Uint32:  tablestore.FieldType_LONG,
+		reflect.Uint64:  tablestore.FieldType_LONG,
+		reflect.Float32: tablestore.FieldType_DOUBLE,
+	}
+
+	//sql.NullTime按时间字段处理
+	nullTypeToIndexTypeMap = map[reflect.Type]tablestore.FieldType{
+		reflect.TypeOf(sql.NullString{}):  tablestore.FieldType_KEYWORD,
+		reflect.TypeOf(sql.NullInt64{}):   tablestore.FieldType_LONG,
+		reflect.TypeOf(sql.NullInt32{}):   tablestore.FieldType_LONG,
+		reflect.TypeOf(sql.NullFloat64{}): tablestore.FieldType_DOUBLE,
+		reflect.TypeOf(sql.NullBool{}):    tablestore.FieldType_BOOLEAN,
 	}
 )
 
+//按默认命名规则获取表名，模型实现了TableName()时使用其返回值
 func GetTableName(obj interface{}) string {
-	v := reflect.Indirect(reflect.ValueOf(obj))
-	return strings.ToLower(v.Type().Name())
+	return NamingStrategy{}.TableName(obj)
+}
+
+//按默认命名规则获取多元索引名，模型实现了IndexName()时使用其返回值
+func GetIndexName(obj interface{}) string {
+	return NamingStrategy{}.IndexName(obj)
 }
 
 func CreateIndexSchema(obj interface{}) ([]*tablestore.FieldSchema, error) {
@@ -43,123 +74,267 @@ func CreateIndexSchema(obj interface{}) ([]*tablestore.FieldSchema, error) {
 		return nil, err
 	}
 
-	fields, err := reflections.Fields(obj)
+	fields, err := getModelFieldNames(obj)
 	if err != nil {
 		return nil, err
 	}
 
+	//虚拟列的名称不能与列名或其他虚拟列重复
+	names := map[string]bool{}
+	for _, column := range fieldToJSONMap {
+		names[column] = true
+	}
+
 	for _, field := range fields {
 		// _id为约定主键，不能创建索引 / json未导出字段也设置索引
 		if v := fieldToJSONMap[field]; v == "_id" || v == "" {
 			continue
 		}
+
+		//虚拟列与字段本身的索引无关，字段不建索引时也可以声明
+		virtualTag, _ := reflections.GetFieldTag(obj, field, "virtual")
+		virtualSchemas, err := virtualFieldSchemas(field, fieldToJSONMap[field], virtualTag)
+		if err != nil {
+			return nil, err
+		}
+		for _, schema := range virtualSchemas {
+			if names[*schema.FieldName] {
+				return nil, fmt.Errorf("field %s virtual field %s conflicts with other field", field, *schema.FieldName)
+			}
+			names[*schema.FieldName] = true
+		}
+
 		//标记为"-"则不创建索引
 		tag, _ := reflections.GetFieldTag(obj, field, "index")
 		if tag == "-" {
+			schemas = append(schemas, virtualSchemas...)
 			continue
 		}
+		indexTag := parseIndexTag(tag)
+		typ, _ := getFieldType(obj, field)
 
 		var fieldType tablestore.FieldType
 		var ok bool
-		if tag != "" {
+		if indexTag.Type != "" {
 			//指定了索引类型，则按指定类型设置
-			fieldType, ok = tagToIndexTypeMap[tag]
+			fieldType, ok = tagToIndexTypeMap[indexTag.Type]
 			if !ok {
 				return nil, fmt.Errorf("unexpected field tag %s %s", field, tag)
 			}
+		} else if customType, custom := getCustomIndexType(typ); custom {
+			//自定义类型声明了索引类型，或者按TableValue()的返回值推断
+			fieldType = customType
+		} else if format, isTime, err := getTimeFormat(obj, field); isTime {
+			//时间字段按存储格式推断
+			if err != nil {
+				return nil, err
+			}
+			fieldType = format.indexType()
+		} else if isNullType(typ) {
+			//sql.Null*类型按包装的类型推断，其他可以为空的类型需要在tag中指定
+			fieldType, ok = nullTypeToIndexTypeMap[typ]
+			if !ok {
+				return nil, fmt.Errorf("unexpected field type %s %s, specify index type by tag", field, typ)
+			}
 		} else {
-			//其余的默认根据字段类型推断索引类型
-			kind, _ := reflections.GetFieldKind(obj, field)
+			//其余的默认根据字段类型推断索引类型，指针按指向的类型推断
+			kind := typ.Kind()
+			if kind == reflect.Ptr {
+				kind = typ.Elem().Kind()
+			}
 			fieldType, ok = kindToIndexTypeMap[kind]
 			if !ok {
 				return nil, fmt.Errorf("unexpected field kind %s %s", field, kind)
 			}
 		}
-		schemas = append(schemas, &tablestore.FieldSchema{
+		schema := &tablestore.FieldSchema{
 			FieldName:        proto.String(fieldToJSONMap[field]),
 			FieldType:        fieldType,
 			Index:            proto.Bool(true),
-			EnableSortAndAgg: proto.Bool(true),
+			EnableSortAndAgg: defaultSortAndAgg(fieldType),
 			Store:            proto.Bool(true),
-		})
+		}
+		if err := setIndexOptions(field, schema, indexTag.Options); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+		schemas = append(schemas, virtualSchemas...)
 	}
 
 	return schemas, nil
 }
 
+//字段名与列名的映射，包括嵌入结构体中的字段，列名已加上嵌入结构体指定的前缀
 func GetFieldNameMap(obj interface{}) (map[string]string, map[string]string, error) {
-	tags, err := reflections.Tags(obj, "json")
+	fields, err := getModelFields(obj)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	fieldToJSONMap := map[string]string{}
 	jsonToFieldMap := map[string]string{}
-	for field, tag := range tags {
+	for _, field := range fields {
 		//json tag可有有2个字段，逗号分隔，只取第一个字段。
-		if jsonName := strings.Split(tag, ",")[0]; jsonName != "-" {
-			fieldToJSONMap[field] = strings.Split(tag, ",")[0]
-			jsonToFieldMap[strings.Split(tag, ",")[0]] = field
+		if field.Column != "-" {
+			fieldToJSONMap[field.Name] = field.Column
+			jsonToFieldMap[field.Column] = field.Name
 		}
 	}
 	return fieldToJSONMap, jsonToFieldMap, nil
 }
 
+//读取整行，行中没有的列，可以为空的字段（指针、sql.Null*、omitempty）会被置为空，其余字段保持不变
 func LoadData(obj interface{}, row *tablestore.Row) error {
 	_, jsonToFieldMap, err := GetFieldNameMap(obj)
 	if err != nil {
 		return fmt.Errorf("get field map err: %w", err)
 	}
 
+	err = loadPrimaryKey(obj, row.PrimaryKey)
+	if err != nil {
+		return err
+	}
+
+	loaded := map[string]bool{}
 	for _, pk := range row.PrimaryKey.PrimaryKeys {
-		err = reflections.SetField(obj, jsonToFieldMap[pk.ColumnName], pk.Value)
+		loaded[pk.ColumnName] = true
+	}
+	for _, attr := range row.Columns {
+		err = setFieldValue(obj, jsonToFieldMap[attr.ColumnName], attr.Value)
 		if err != nil {
-			//TODO:可以更详细 target type receive type
 			return err
 		}
+		loaded[attr.ColumnName] = true
 	}
 
-	for _, attr := range row.Columns {
-		err = reflections.SetField(obj, jsonToFieldMap[attr.ColumnName], attr.Value)
-		if err != nil {
+	for column, field := range jsonToFieldMap {
+		if loaded[column] || !isNullableField(obj, field) {
+			continue
+		}
+		if err := clearFieldValue(obj, field); err != nil {
 			return err
 		}
 	}
 
-	return err
+	return nil
+}
+
+//只填充主键，用于写入后回填自增ID等只有主键的场景，不影响其他字段
+func loadPrimaryKey(obj interface{}, primaryKey *tablestore.PrimaryKey) error {
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	if err != nil {
+		return fmt.Errorf("get field map err: %w", err)
+	}
+
+	for i, pk := range primaryKey.PrimaryKeys {
+		value := pk.Value
+		//开启哈希前缀时去掉分区键的前缀，还原为业务ID
+		if i == 0 {
+			value, err = decodeID(obj, value)
+			if err != nil {
+				return err
+			}
+		}
+		err = reflections.SetField(obj, jsonToFieldMap[pk.ColumnName], value)
+		if err != nil {
+			//TODO:可以更详细 target type receive type
+			return err
+		}
+	}
+	return nil
 }
 
 //检查模型定义是否符合要求，防止出错
 func CheckModel(obj interface{}) error {
-	items, err := reflections.Items(obj)
+	fields, err := getModelFields(obj)
 	if err != nil {
 		return err
 	}
 
-	isIDFieldExist := false
+	//展开嵌入结构体后，同一层级的列名不能重复
+	items := map[string]interface{}{}
+	columns := map[string]string{}
+	for _, field := range fields {
+		items[field.Name], err = reflections.GetField(obj, field.Name)
+		if err != nil {
+			return err
+		}
+		if field.Column == "" || field.Column == "-" {
+			continue
+		}
+		if other, ok := columns[field.Column]; ok {
+			return fmt.Errorf("field %s and %s have the same column %s", other, field.Name, field.Column)
+		}
+		columns[field.Column] = field.Name
+	}
 
-	//检查字段类型是否符合TableStore要求，目前仅支持int64,float64,string,[]byte,bool
+	//检查字段类型是否符合TableStore要求，目前仅支持整数,浮点数,string,[]byte,bool,time.Time及它们的指针,sql.Null*
 	for field, value := range items {
 		//只检查包含json tag的字段，因为只有这些字段会存入数据库
 		tag, _ := reflections.GetFieldTag(obj, field, "json")
 		if tag != "" && strings.Split(tag, ",")[0] != "-" {
-			//标注"_id"是否存在
-			if strings.Split(tag, ",")[0] == "_id" {
-				isIDFieldExist = true
-			}
-
 			//类型检查
 			switch value.(type) {
-			case int64, float64, string, []byte, bool:
+			case string, []byte, bool, *string, *[]byte, *bool:
+			case time.Time, *time.Time, sql.NullTime:
+				if _, _, err := getTimeFormat(obj, field); err != nil {
+					return err
+				}
 			default:
-				return fmt.Errorf("field %s must be one of (int64,float64,string,[]byte,bool), it's %s now", field, reflect.ValueOf(value).Type())
+				//数字以及指向数字的指针，sql.Null*类型，实现了Valuer和Scanner的自定义类型
+				typ := reflect.TypeOf(value)
+				isTableValue, err := checkTableValueType(field, typ)
+				if err != nil {
+					return err
+				}
+				if isTableValue || isNullType(typ) {
+					continue
+				}
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				if !isNumberKind(typ.Kind()) {
+					return fmt.Errorf("field %s must be one of (integer,float,string,[]byte,bool,time.Time), their pointers, sql.Null* types or types implementing tableorm.Valuer and tableorm.Scanner, it's %s now", field, reflect.ValueOf(value).Type())
+				}
+			}
+		}
+	}
+
+	//自动时间戳字段只能是数字或时间类型
+	if _, err := getAutoTimeFields(obj); err != nil {
+		return err
+	}
+
+	//没有pk tag时"_id"必须存在，有pk tag时检查顺序是否正确
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return err
+	}
+
+	//主键只支持string,int64,[]byte，自增列必须为int64且不能是分区键
+	for i, pkField := range pkFields {
+		pkType, err := getPrimaryKeyType(obj, pkField)
+		if err != nil {
+			return err
+		}
+		if pkField.Generator == nil {
+			continue
+		}
+		if isAutoIncrement(pkField.Generator) {
+			if i == 0 {
+				return fmt.Errorf("auto increment primary key %s can not be partition key", pkField.Field)
+			}
+			if pkType != tablestore.PrimaryKeyType_INTEGER {
+				return fmt.Errorf("auto increment primary key %s must be int64", pkField.Field)
 			}
+		} else if pkType != tablestore.PrimaryKeyType_STRING {
+			return fmt.Errorf("generated primary key %s must be string", pkField.Field)
 		}
 	}
 
-	//"_id"是否存在
-	if !isIDFieldExist {
-		return IDFieldNotExist
+	//二级索引对表级配置的要求
+	if err := checkSecondaryIndexTableOptions(obj); err != nil {
+		return err
 	}
 
 	//TODO: 索引是否设置正确
@@ -167,43 +342,119 @@ func CheckModel(obj interface{}) error {
 	return err
 }
 
-//检查ID是否为空，为空自动生成一个uuid
+//检查需要生成的主键是否为空，为空时使用对应的ID生成器生成，_id默认为uuid
+//自增ID由服务端在写入时生成，这里不做处理，返回值为_id，没有_id时为空
 func EnsureID(obj interface{}) (string, error) {
-	_, jsonToFieldMap, err := GetFieldNameMap(obj)
+	pkFields, err := getPrimaryKeyFields(obj)
 	if err != nil {
 		return "", err
 	}
 
-	fieldName, ok := jsonToFieldMap["_id"]
-	if !ok {
-		return "", fmt.Errorf("error finding Field Name for _id")
+	id := ""
+	for _, pkField := range pkFields {
+		value, err := reflections.GetField(obj, pkField.Field)
+		if err != nil {
+			return "", err
+		}
+		if pkField.Generator == nil || isAutoIncrement(pkField.Generator) {
+			continue
+		}
+
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("field %s must be string, it's %T now", pkField.Field, value)
+		}
+		if reflect.ValueOf(s).IsZero() {
+			s, err = pkField.Generator.NewID()
+			if err != nil {
+				return "", err
+			}
+			err := reflections.SetField(obj, pkField.Field, s)
+			if err != nil {
+				return "", err
+			}
+		}
+		if pkField.Column == "_id" {
+			id = s
+		}
 	}
 
-	valueID, err := reflections.GetField(obj, fieldName)
+	return id, nil
+}
+
+//读取_id，不存在时不会自动生成，复合主键请使用GetPrimaryKeyValues
+func GetID(obj interface{}) (interface{}, error) {
+	_, jsonToFieldMap, err := GetFieldNameMap(obj)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	id := valueID.(string)
-	if reflect.ValueOf(id).IsZero() {
-		id = uuid.NewV4().String()
-		err := reflections.SetField(obj, fieldName, id)
-		if err != nil {
-			return "", err
-		}
+	fieldName, ok := jsonToFieldMap["_id"]
+	if !ok {
+		return nil, IDFieldNotExist
 	}
 
-	return id, err
+	return reflections.GetField(obj, fieldName)
 }
 
+//覆盖写入，不关心行是否存在
+//表名按默认命名规则生成，设置了NamingStrategy时使用db.GetSaveRowChange，下同
 func GetSaveRowChange(obj interface{}) (*tablestore.PutRowChange, error) {
+	return getPutRowChange(obj, GetTableName(obj), tablestore.RowExistenceExpectation_IGNORE)
+}
+
+//仅在行不存在时写入，用于创建，防止并发时重复创建
+func GetCreateRowChange(obj interface{}) (*tablestore.PutRowChange, error) {
+	return getPutRowChange(obj, GetTableName(obj), tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+}
+
+func GetUpdateRowChange(obj interface{}) (*tablestore.UpdateRowChange, error) {
+	return getUpdateRowChange(obj, GetTableName(obj))
+}
+
+func GetDeleteRowChange(obj interface{}) (*tablestore.DeleteRowChange, error) {
+	return getDeleteRowChange(obj, GetTableName(obj))
+}
+
+//与同名的函数相同，表名按db的命名规则生成
+func (db *DB) GetSaveRowChange(obj interface{}) (*tablestore.PutRowChange, error) {
+	return getPutRowChange(obj, db.tableName(obj), tablestore.RowExistenceExpectation_IGNORE)
+}
+
+func (db *DB) GetCreateRowChange(obj interface{}) (*tablestore.PutRowChange, error) {
+	return getPutRowChange(obj, db.tableName(obj), tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+}
+
+func (db *DB) GetUpdateRowChange(obj interface{}) (*tablestore.UpdateRowChange, error) {
+	return getUpdateRowChange(obj, db.tableName(obj))
+}
+
+func (db *DB) GetDeleteRowChange(obj interface{}) (*tablestore.DeleteRowChange, error) {
+	return getDeleteRowChange(obj, db.tableName(obj))
+}
+
+func getPutRowChange(obj interface{}, tableName string, expectation tablestore.RowExistenceExpectation) (*tablestore.PutRowChange, error) {
 	//没有ID则创建ID，有则忽略
 	_, err := EnsureID(obj)
 	if err != nil {
 		return nil, err
 	}
 
-	fields, err := reflections.Fields(obj)
+	pkFields, err := getPrimaryKeyFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	//整行写入，创建时间为空时填充，更新时间每次填充
+	timeFields, err := getAutoTimeFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := timeFields.fill(obj, true); err != nil {
+		return nil, err
+	}
+
+	fields, err := getModelFieldNames(obj)
 	if err != nil {
 		return nil, err
 	}
@@ -214,40 +465,216 @@ func GetSaveRowChange(obj interface{}) (*tablestore.PutRowChange, error) {
 	}
 
 	putRowChange := new(tablestore.PutRowChange)
+	putRowChange.PrimaryKey = new(tablestore.PrimaryKey)
+
+	//主键按顺序写入
+	isPrimaryKey := map[string]bool{}
+	for i, pkField := range pkFields {
+		isPrimaryKey[pkField.Field] = true
+		value, _ := reflections.GetField(obj, pkField.Field)
+
+		//自增ID为空时由服务端生成，并在响应中返回主键，用于回填
+		if pkField.Generator != nil && isAutoIncrement(pkField.Generator) && reflect.ValueOf(value).IsZero() {
+			putRowChange.PrimaryKey.AddPrimaryKeyColumnWithAutoIncrement(pkField.Column)
+			putRowChange.SetReturnPk()
+			continue
+		}
+		if i == 0 {
+			value, err = encodeID(obj, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		putRowChange.PrimaryKey.AddPrimaryKeyColumn(pkField.Column, value)
+	}
 
 	for _, field := range fields {
-		value, _ := reflections.GetField(obj, field)
 		column := fieldToJSONMap[field]
-		if column == "_id" {
-			pk := new(tablestore.PrimaryKey)
-			pk.AddPrimaryKeyColumn(column, value)
-			putRowChange.PrimaryKey = pk
+		if isPrimaryKey[field] {
+			continue
 		} else if column != "" && strings.Split(column, "-")[0] != "-" {
-			putRowChange.AddColumn(column, value)
+			value, ok, err := getColumnValue(obj, field)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				putRowChange.AddColumn(column, value)
+			}
 		} else {
 			continue
 		}
 	}
 
-	putRowChange.TableName = GetTableName(obj)
-	putRowChange.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	putRowChange.TableName = tableName
+	putRowChange.SetCondition(expectation)
 	return putRowChange, nil
 }
 
-func GetDeleteRowChange(obj interface{}) (*tablestore.DeleteRowChange, error) {
-	id, _ := EnsureID(obj)
+//仅在行存在时更新，只覆盖结构体中的列，不影响其他列
+func getUpdateRowChange(obj interface{}, tableName string) (*tablestore.UpdateRowChange, error) {
+	emptyKey, err := hasEmptyGeneratedKey(obj)
+	if err != nil {
+		return nil, err
+	}
+	if emptyKey {
+		return nil, fmt.Errorf("update row error, primary key is empty")
+	}
+
+	fields, err := getModelFieldNames(obj)
+	if err != nil {
+		return nil, err
+	}
 
-	pk := new(tablestore.PrimaryKey)
-	pk.AddPrimaryKeyColumn("_id", id)
+	fieldToJSONMap, _, err := GetFieldNameMap(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	//更新时只填充更新时间，创建时间不写入，保留数据库中原有的值
+	timeFields, err := getAutoTimeFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := timeFields.fill(obj, false); err != nil {
+		return nil, err
+	}
+
+	pk, err := GetPrimaryKey(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	updateRowChange := new(tablestore.UpdateRowChange)
+	updateRowChange.TableName = tableName
+	updateRowChange.PrimaryKey = pk
+
+	isPrimaryKey := map[string]bool{}
+	for _, pkColumn := range pk.PrimaryKeys {
+		isPrimaryKey[pkColumn.ColumnName] = true
+	}
+
+	for _, field := range fields {
+		column := fieldToJSONMap[field]
+		if column == "" || isPrimaryKey[column] {
+			continue
+		}
+		if _, ok := timeFields.create[field]; ok {
+			continue
+		}
+		unset, err := isUnsetField(obj, field)
+		if err != nil {
+			return nil, err
+		}
+		if unset {
+			continue
+		}
+		value, ok, err := getColumnValue(obj, field)
+		if err != nil {
+			return nil, err
+		}
+		//值为空时删除该列，之后读取为空，未设置的字段已经跳过，不会删除
+		if ok {
+			updateRowChange.PutColumn(column, value)
+		} else {
+			updateRowChange.DeleteColumn(column)
+		}
+	}
+
+	updateRowChange.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	return updateRowChange, nil
+}
+
+func getDeleteRowChange(obj interface{}, tableName string) (*tablestore.DeleteRowChange, error) {
+	//与更新相同，主键为空时不会删除任何行，多半是调用方忘记设置ID
+	emptyKey, err := hasEmptyGeneratedKey(obj)
+	if err != nil {
+		return nil, err
+	}
+	if emptyKey {
+		return nil, fmt.Errorf("delete row error, primary key is empty")
+	}
+
+	pk, err := GetPrimaryKey(obj)
+	if err != nil {
+		return nil, err
+	}
 
 	deleteRowChange := new(tablestore.DeleteRowChange)
-	deleteRowChange.TableName = GetTableName(obj)
+	deleteRowChange.TableName = tableName
 	deleteRowChange.PrimaryKey = pk
 	deleteRowChange.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
 
 	return deleteRowChange, nil
 }
 
+//展开后的单行对象，obj总是结构体指针
+//addressable为false时obj是调用方传入值的拷贝，对它的修改不会反映到调用方
+type rowObject struct {
+	obj         interface{}
+	addressable bool
+}
+
+//生成写入请求，值的拷贝无法回填生成的ID，此时要求ID已经设置
+func (row rowObject) saveRowChange(db *DB) (*tablestore.PutRowChange, error) {
+	if !row.addressable {
+		emptyKey, err := hasEmptyGeneratedKey(row.obj)
+		if err != nil {
+			return nil, err
+		}
+		if emptyKey {
+			return nil, fmt.Errorf("%w: can not write generated primary key back to %T", NotAddressable, reflect.ValueOf(row.obj).Elem().Interface())
+		}
+	}
+	return db.GetSaveRowChange(row.obj)
+}
+
+//展开Save/Delete传入的对象，支持 *T、T、[]T、[]*T 以及它们的指针
+func expandObjects(objList []interface{}) ([]rowObject, error) {
+	rows := []rowObject{}
+	for _, obj := range objList {
+		items, err := expandObject(reflect.ValueOf(obj), false)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, items...)
+	}
+	return rows, nil
+}
+
+func expandObject(v reflect.Value, addressable bool) ([]rowObject, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil pointer of %s", v.Type())
+		}
+		return expandObject(v.Elem(), true)
+	case reflect.Interface:
+		return expandObject(v.Elem(), addressable)
+	case reflect.Struct:
+		if addressable && v.CanAddr() {
+			return []rowObject{{obj: v.Addr().Interface(), addressable: true}}, nil
+		}
+		//值类型无法回写，拷贝一份用于生成写入请求
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return []rowObject{{obj: ptr.Interface(), addressable: false}}, nil
+	case reflect.Slice, reflect.Array:
+		rows := []rowObject{}
+		//slice的元素共享底层数组，即使slice本身按值传入，元素也是可以回写的
+		elemAddressable := v.Kind() == reflect.Slice || addressable
+		for i := 0; i < v.Len(); i++ {
+			items, err := expandObject(v.Index(i), elemAddressable)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, items...)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("unexpected object kind %s, must be struct, pointer or slice", v.Kind())
+	}
+}
+
 //判断是否部分失败，一般概率较小，因为所有请求都是统一格式的且为Ignore，不容易有这种错误
 //但是一旦发生不好排查，因为pk是空的，无法确认是那个对象失败了
 func GetBatchWriteResult(resp *tablestore.BatchWriteRowResponse) error {
@@ -0,0 +1,147 @@
+package tableorm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+	"time"
+)
+
+//自定义类型写入TableStore时的转换，例如 Money、Email、枚举
+//返回值为int64、float64、string、[]byte、bool，其他数字类型会自动扩展，time.Time按默认格式存储，返回nil时视为空
+type Valuer interface {
+	TableValue() (interface{}, error)
+}
+
+//自定义类型从TableStore读取时的转换，value为int64、float64、string、[]byte、bool之一
+type Scanner interface {
+	ScanTableValue(value interface{}) error
+}
+
+//自定义类型声明自己的索引类型，没有实现时按零值TableValue()的返回值推断，也可以在index tag中指定
+type IndexTyper interface {
+	TableIndexType() tablestore.FieldType
+}
+
+var (
+	tableValuerType  = reflect.TypeOf((*Valuer)(nil)).Elem()
+	tableScannerType = reflect.TypeOf((*Scanner)(nil)).Elem()
+	indexTyperType   = reflect.TypeOf((*IndexTyper)(nil)).Elem()
+)
+
+//类型或其指针是否实现了接口，指针字段按指向的类型判断
+func implements(typ, iface reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Implements(iface) || reflect.PtrTo(typ).Implements(iface)
+}
+
+//自定义类型需要同时实现Valuer和Scanner，否则写入或读取时会失败
+func checkTableValueType(field string, typ reflect.Type) (bool, error) {
+	isValuer, isScanner := implements(typ, tableValuerType), implements(typ, tableScannerType)
+	if isValuer != isScanner {
+		return false, fmt.Errorf("field %s of type %s must implement both tableorm.Valuer and tableorm.Scanner", field, typ)
+	}
+	return isValuer, nil
+}
+
+//转换为Valuer，方法定义在指针上时复制到新的指针上
+//不依赖字段是否可寻址，直接传入结构体值或者查询条件中的值也可以转换
+func asValuer(value interface{}) (Valuer, bool) {
+	if valuer, ok := value.(Valuer); ok {
+		return valuer, true
+	}
+
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || v.Kind() == reflect.Ptr {
+		return nil, false
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	valuer, ok := ptr.Interface().(Valuer)
+	return valuer, ok
+}
+
+//通过TableValue取列值，ok为false表示字段没有实现Valuer
+//value为nil时表示值为空
+func getTableValue(field string, value interface{}) (result interface{}, ok bool, err error) {
+	valuer, ok := asValuer(value)
+	if !ok {
+		return nil, false, nil
+	}
+
+	result, err = valuer.TableValue()
+	if err != nil {
+		return nil, true, fmt.Errorf("get table value of field %s error: %w", field, err)
+	}
+	if result == nil {
+		return nil, true, nil
+	}
+	if t, isTime := result.(time.Time); isTime {
+		return DefaultTimeFormat.encode(t), true, nil
+	}
+
+	result, err = toColumnNumber(field, result)
+	if err != nil {
+		return nil, true, err
+	}
+	switch result.(type) {
+	case int64, float64, string, []byte, bool:
+		return result, true, nil
+	}
+	return nil, true, fmt.Errorf("table value of field %s must be one of (integer,float,string,[]byte,bool,time.Time), it's %T now", field, result)
+}
+
+//通过ScanTableValue给字段赋值，ok为false表示字段没有实现Scanner
+//指针字段先分配再赋值
+func scanTableValue(obj interface{}, field string, value interface{}) (ok bool, err error) {
+	if reflect.ValueOf(obj).Kind() != reflect.Ptr {
+		return false, nil
+	}
+	fieldValue := reflect.ValueOf(obj).Elem().FieldByName(field)
+	typ := fieldValue.Type()
+	scan := func(scanner Scanner) error {
+		if err := scanner.ScanTableValue(value); err != nil {
+			return fmt.Errorf("scan table value of field %s error: %w", field, err)
+		}
+		return nil
+	}
+
+	switch {
+	case reflect.PtrTo(typ).Implements(tableScannerType):
+		return true, scan(fieldValue.Addr().Interface().(Scanner))
+	case typ.Kind() == reflect.Ptr && typ.Implements(tableScannerType):
+		ptr := reflect.New(typ.Elem())
+		if err := scan(ptr.Interface().(Scanner)); err != nil {
+			return true, err
+		}
+		fieldValue.Set(ptr)
+		return true, nil
+	}
+	return false, nil
+}
+
+//自定义类型的索引类型，优先使用IndexTyper声明的类型，否则按零值TableValue()的返回值推断
+//ok为false表示不是自定义类型或者无法推断
+func getCustomIndexType(typ reflect.Type) (tablestore.FieldType, bool) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(indexTyperType) {
+		return reflect.New(typ).Interface().(IndexTyper).TableIndexType(), true
+	}
+	if !reflect.PtrTo(typ).Implements(tableValuerType) {
+		return 0, false
+	}
+
+	value, err := reflect.New(typ).Interface().(Valuer).TableValue()
+	if err != nil || value == nil {
+		return 0, false
+	}
+	if _, ok := value.(time.Time); ok {
+		return DefaultTimeFormat.indexType(), true
+	}
+	fieldType, ok := kindToIndexTypeMap[reflect.TypeOf(value).Kind()]
+	return fieldType, ok
+}
@@ -0,0 +1,245 @@
+package tableorm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//以分为单位存储的金额
+type valuerMoney struct {
+	Cents int64
+}
+
+func (m *valuerMoney) TableValue() (interface{}, error) {
+	return m.Cents, nil
+}
+
+func (m *valuerMoney) ScanTableValue(value interface{}) error {
+	cents, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected money value %T", value)
+	}
+	m.Cents = cents
+	return nil
+}
+
+//存储为小写字符串的枚举，声明为KEYWORD索引
+type valuerStatus string
+
+func (s valuerStatus) TableValue() (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return strings.ToLower(string(s)), nil
+}
+
+func (s *valuerStatus) ScanTableValue(value interface{}) error {
+	*s = valuerStatus(strings.ToUpper(value.(string)))
+	return nil
+}
+
+func (valuerStatus) TableIndexType() tablestore.FieldType {
+	return tablestore.FieldType_KEYWORD
+}
+
+//只实现了Valuer
+type valuerOnly int
+
+func (v valuerOnly) TableValue() (interface{}, error) {
+	return int64(v), nil
+}
+
+type valuerPayment struct {
+	ID     string       `json:"_id"`
+	Amount valuerMoney  `json:"amount"`
+	Refund *valuerMoney `json:"refund"`
+	Status valuerStatus `json:"status"`
+}
+
+func TestValuerColumnValue(t *testing.T) {
+	payment := &valuerPayment{ID: "1", Amount: valuerMoney{Cents: 1250}, Status: "PAID"}
+
+	value, ok, err := getColumnValue(payment, "Amount")
+	if err != nil || !ok || value != int64(1250) {
+		t.Errorf("amount = %v, %v, %v", value, ok, err)
+	}
+	value, ok, err = getColumnValue(payment, "Status")
+	if err != nil || !ok || value != "paid" {
+		t.Errorf("status = %v, %v, %v", value, ok, err)
+	}
+
+	//空指针和返回nil的TableValue不写入
+	for _, field := range []string{"Refund", "Status"} {
+		_, ok, err := getColumnValue(&valuerPayment{}, field)
+		if err != nil || ok {
+			t.Errorf("%s: empty value ok = %v, err = %v", field, ok, err)
+		}
+	}
+}
+
+func TestScannerSetFieldValue(t *testing.T) {
+	payment := &valuerPayment{}
+	if err := setFieldValue(payment, "Amount", int64(990)); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFieldValue(payment, "Refund", int64(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFieldValue(payment, "Status", "refunded"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &valuerPayment{Amount: valuerMoney{Cents: 990}, Refund: &valuerMoney{Cents: 100}, Status: "REFUNDED"}
+	if !reflect.DeepEqual(payment, want) {
+		t.Errorf("payment = %+v, want %+v", payment, want)
+	}
+
+	if err := setFieldValue(payment, "Amount", "9.90"); err == nil {
+		t.Error("scan error should be returned")
+	}
+}
+
+func TestCheckTableValueType(t *testing.T) {
+	tests := []struct {
+		typ     reflect.Type
+		custom  bool
+		wantErr bool
+	}{
+		{reflect.TypeOf(valuerMoney{}), true, false},
+		{reflect.TypeOf(&valuerMoney{}), true, false},
+		{reflect.TypeOf(valuerStatus("")), true, false},
+		{reflect.TypeOf(valuerOnly(0)), false, true},
+		{reflect.TypeOf(""), false, false},
+	}
+	for _, tt := range tests {
+		custom, err := checkTableValueType("Field", tt.typ)
+		if custom != tt.custom || (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkTableValueType() = %v, %v", tt.typ, custom, err)
+		}
+	}
+}
+
+func TestGetCustomIndexType(t *testing.T) {
+	tests := []struct {
+		typ  reflect.Type
+		want tablestore.FieldType
+		ok   bool
+	}{
+		{reflect.TypeOf(valuerMoney{}), tablestore.FieldType_LONG, true},
+		{reflect.TypeOf(&valuerMoney{}), tablestore.FieldType_LONG, true},
+		{reflect.TypeOf(valuerStatus("")), tablestore.FieldType_KEYWORD, true},
+		{reflect.TypeOf(int64(0)), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := getCustomIndexType(tt.typ)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: getCustomIndexType() = %v, %v, want %v, %v", tt.typ, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValuerError(t *testing.T) {
+	type broken struct {
+		Value valuerBroken `json:"value"`
+	}
+	_, _, err := getColumnValue(&broken{}, "Value")
+	if !errors.Is(err, errValuerBroken) {
+		t.Errorf("getColumnValue() error = %v, want %v", err, errValuerBroken)
+	}
+}
+
+var errValuerBroken = errors.New("broken")
+
+type valuerBroken struct{}
+
+func (valuerBroken) TableValue() (interface{}, error) {
+	return nil, errValuerBroken
+}
+
+func (*valuerBroken) ScanTableValue(value interface{}) error {
+	return nil
+}
+
+//方法定义在指针上的自定义类型
+type testCents int64
+
+func (c *testCents) TableValue() (interface{}, error) {
+	return fmt.Sprintf("%d.%02d", int64(*c)/100, int64(*c)%100), nil
+}
+
+func (c *testCents) ScanTableValue(value interface{}) error {
+	return nil
+}
+
+//方法定义在值上的自定义类型
+type testLevel int
+
+func (l testLevel) TableValue() (interface{}, error) {
+	return int(l) * 10, nil
+}
+
+func (l *testLevel) ScanTableValue(value interface{}) error {
+	return nil
+}
+
+type testOrder struct {
+	ID    string    `json:"_id"`
+	Price testCents `json:"price"`
+	Level testLevel `json:"level"`
+}
+
+func TestGetColumnValueValuer(t *testing.T) {
+	order := testOrder{ID: "1", Price: 1250, Level: 2}
+	tests := []struct {
+		name  string
+		obj   interface{}
+		field string
+		want  interface{}
+	}{
+		{"pointer receiver on pointer", &order, "Price", "12.50"},
+		{"pointer receiver on value", order, "Price", "12.50"},
+		{"value receiver on pointer", &order, "Level", int64(20)},
+		{"value receiver on value", order, "Level", int64(20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := getColumnValue(tt.obj, tt.field)
+			if err != nil || !ok {
+				t.Fatalf("getColumnValue() = %v, %v, %v", got, ok, err)
+			}
+			if got != tt.want {
+				t.Errorf("getColumnValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertQueryValuesValuer(t *testing.T) {
+	query := &search.BoolQuery{
+		MustQueries: []search.Query{
+			&search.TermQuery{FieldName: "price", Term: testCents(1250)},
+			&search.TermsQuery{FieldName: "level", Terms: []interface{}{testLevel(1), testLevel(2)}},
+			&search.RangeQuery{FieldName: "price", From: testCents(100), To: nil},
+		},
+	}
+	converted, err := convertQueryValues(&testOrder{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must := converted.(*search.BoolQuery).MustQueries
+
+	if got := must[0].(*search.TermQuery).Term; got != "12.50" {
+		t.Errorf("term = %#v, want %#v", got, "12.50")
+	}
+	if got, want := must[1].(*search.TermsQuery).Terms, []interface{}{int64(10), int64(20)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("terms = %#v, want %#v", got, want)
+	}
+	if got := must[2].(*search.RangeQuery).From; got != "1.00" {
+		t.Errorf("range from = %#v, want %#v", got, "1.00")
+	}
+}